@@ -1,80 +1,79 @@
 package client
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/xorium/wormwhole/core"
-	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-	"os/exec"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
 	reconnectTimeout    = 5 * time.Second
+	killGracePeriod     = 5 * time.Second
 	maxResponseRetriesN = 4
 	settingsFile        = ".settings.json"
+	credentialFile      = ".credential"
+	defaultInterpreter  = "bash"
 )
 
-type Shell struct {
-	cmd *exec.Cmd
+// fatalError is the connection error retrying can't fix.
+type fatalError struct {
+	reason string
 }
 
-func NewShell() *Shell {
-	var stdin, stdout bytes.Buffer
-	shellCmd := exec.Command("/bin/bash")
-	shellCmd.Stdin = &stdin
-	shellCmd.Stdout = &stdout
-	shellCmd.Stderr = &stdout
-	_ = shellCmd.Start()
-
-	return &Shell{
-		cmd: shellCmd,
-	}
+func (e *fatalError) Error() string {
+	return e.reason
 }
 
-func (s *Shell) Write(input string) {
-	stdin, _ := s.cmd.StdinPipe()
-	_, _ = io.WriteString(stdin, input)
-	_ = stdin.Close()
-}
-
-func (s *Shell) Read() string {
-	stdout, _ := s.cmd.StdoutPipe()
-	stderr, _ := s.cmd.StderrPipe()
-	reader := io.MultiReader(stdout, stderr)
-	_ = stdout.Close()
-	_ = stderr.Close()
-	data, _ := bufio.NewReader(reader).Peek(5)
-	return string(data)
-}
+type commandHandler func(ctx context.Context, cmd *core.Command) (code string, resp []byte)
 
 type Client struct {
 	*sync.RWMutex
 	Debug       bool
-	serverAddr  string
-	proto       string
-	conn        *websocket.Conn
-	cmdHandlers map[string]func(command *core.Command) (code string, resp []byte)
-	settings    map[string]interface{}
-	shell       *Shell
+	JoinToken   string
+	Interpreter string
+	// interval of pushing metrics, zero disables them
+	MetricsInterval time.Duration
+	serverAddr      string
+	proto           string
+	conn            *websocket.Conn
+	writeLock       *sync.Mutex
+	tlsConfig       *tls.Config
+	httpClient      *http.Client
+	cmdHandlers     map[string]commandHandler
+	running         map[string]context.CancelFunc
+	settings        map[string]interface{}
+	ptySessions     map[string]*ptySession
+	execSessions    map[string]*execSession
+	uploads         map[string]*fileUpload
+	scriptRoot      string
 }
 
 func NewClient(serverAddr, proto string) *Client {
-	bashCmd := exec.Command("bash")
-	_ = bashCmd.Start()
-
 	return &Client{
-		RWMutex:    new(sync.RWMutex),
-		serverAddr: serverAddr,
-		proto:      proto,
-		settings:   make(map[string]interface{}),
-		//shell: NewShell(),
+		RWMutex:         new(sync.RWMutex),
+		serverAddr:      serverAddr,
+		proto:           proto,
+		Interpreter:     defaultInterpreter,
+		MetricsInterval: defaultMetricsInterval,
+		settings:        make(map[string]interface{}),
+		running:         make(map[string]context.CancelFunc),
+		writeLock:       new(sync.Mutex),
+		httpClient:      &http.Client{Timeout: 30 * time.Second},
+
+		ptySessions:  make(map[string]*ptySession),
+		execSessions: make(map[string]*execSession),
+		uploads:      make(map[string]*fileUpload),
 	}
 }
 
@@ -90,57 +89,165 @@ func (c *Client) getOrCreateUUID() string {
 	return currUUID
 }
 
-func (c *Client) initConn() {
+func (c *Client) initConn() error {
 	wsServer := fmt.Sprintf("%s://%s/in?uuid=%s", c.proto, c.serverAddr, c.getOrCreateUUID())
 	for {
-		conn, _, err := websocket.DefaultDialer.Dial(wsServer, nil)
+		credential, err := c.getOrEnrollCredential()
+		if _, fatal := err.(*fatalError); fatal {
+			return err
+		}
 		if err != nil {
+			log.Println("error while trying to enroll: ", err)
+			time.Sleep(reconnectTimeout)
+			continue
+		}
+		header := http.Header{}
+		header.Set(core.CredentialHeader, credential)
+		conn, resp, err := c.dialer().Dial(wsServer, header)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusUnauthorized && isCredentialRejected(resp) {
+				if err := c.credentialRejected(); err != nil {
+					return err
+				}
+				continue
+			}
 			log.Println("error while trying to connect: ", err)
-			goto retry
+			time.Sleep(reconnectTimeout)
+			continue
 		}
 		c.Lock()
 		c.conn = conn
 		c.Unlock()
 		log.Println("Connection has been established.")
-		return
-	retry:
-		time.Sleep(reconnectTimeout)
+		c.sendHello(collectFacts())
+		return nil
 	}
 }
 
-func (c *Client) getCommand() *core.Command {
-	if c.conn == nil {
-		c.initConn()
+func isCredentialRejected(resp *http.Response) bool {
+	body, err := ioutil.ReadAll(resp.Body)
+	return err == nil && strings.TrimSpace(string(body)) == core.CredentialRejected
+}
+
+// credentialRejected drops the revoked credential, so the bot enrolls
+// again if it has the join token.
+func (c *Client) credentialRejected() error {
+	log.Println("bot credential has been rejected by the server")
+	if err := c.removeCredential(); err != nil {
+		return &fatalError{fmt.Sprintf("can't remove rejected credential: %v", err)}
+	}
+	if c.JoinToken == "" {
+		return &fatalError{"bot credential has been revoked, join token is required to enroll again"}
+	}
+	return nil
+}
+
+// getOrEnrollCredential returns the stored bot credential or exchanges the
+// join token for a new one.
+func (c *Client) getOrEnrollCredential() (string, error) {
+	if credential := c.loadCredential(); credential != "" {
+		return credential, nil
+	}
+	if c.JoinToken == "" {
+		return "", &fatalError{"bot is not enrolled, join token is required"}
+	}
+
+	enrollUrl := fmt.Sprintf(
+		"%s://%s/enroll?uuid=%s&token=%s",
+		c.httpScheme(), c.serverAddr, c.getOrCreateUUID(), url.QueryEscape(c.JoinToken),
+	)
+	resp, err := c.httpClient.Post(enrollUrl, "text/plain", nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return "", &fatalError{"enrollment has been rejected: " + strings.TrimSpace(string(body))}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected enrollment status: %s", resp.Status)
+	}
+
+	credential := strings.TrimSpace(string(body))
+	if err := c.saveCredential(credential); err != nil {
+		return "", fmt.Errorf("can't save credential: %v", err)
+	}
+	log.Println("Bot has been enrolled.")
+	return credential, nil
+}
+
+func (c *Client) getMessage() (*core.Message, error) {
+	c.RLock()
+	conn := c.conn
+	c.RUnlock()
+	if conn == nil {
+		if err := c.initConn(); err != nil {
+			return nil, err
+		}
 	}
-	cmd := new(core.Command)
 	for {
 		if c.Debug {
-			log.Println("Trying to read command from connection.")
+			log.Println("Trying to read message from connection.")
 		}
-		if err := c.conn.ReadJSON(cmd); err != nil {
-			log.Println("can't read command from connection: ", err)
-			c.initConn()
+		msg := new(core.Message)
+		c.RLock()
+		conn = c.conn
+		c.RUnlock()
+		if err := conn.ReadJSON(msg); err != nil {
+			log.Println("can't read message from connection: ", err)
+			_ = conn.Close()
+			if err := c.initConn(); err != nil {
+				return nil, err
+			}
 			continue
 		}
-		break
+		if c.Debug {
+			log.Println("Message has been received: ", msg.Type)
+		}
+		return msg, nil
 	}
-	if c.Debug {
-		log.Println("Command has been received: ", cmd)
+}
+
+func (c *Client) send(msg *core.Message) error {
+	c.RLock()
+	conn := c.conn
+	c.RUnlock()
+	if conn == nil {
+		return fmt.Errorf("connection is not established")
 	}
-	return cmd
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return conn.WriteJSON(msg)
 }
 
 func (c *Client) sendCommandResp(cmd *core.Command, code string, resp []byte) {
-	postUrl := fmt.Sprintf(
-		"http://%s/out?cid=%s&code=%s", c.serverAddr, cmd.ID, code,
-	)
-	req, err := http.NewRequest(http.MethodPost, postUrl, bytes.NewBuffer(resp))
-	if err != nil {
-		log.Println(err)
+	err := c.send(core.NewResultMessage(cmd.ID, code, resp))
+	if err == nil {
 		return
 	}
+	log.Printf("can't send command %s result over websocket: %v\n", cmd.Name, err)
+	c.postCommandResp(cmd, code, resp)
+}
+
+// postCommandResp sends the command result via the /out HTTP endpoint,
+// which is kept as a fallback for broken websocket connections.
+func (c *Client) postCommandResp(cmd *core.Command, code string, resp []byte) {
+	postUrl := fmt.Sprintf(
+		"%s://%s/out?cid=%s&code=%s&uuid=%s",
+		c.httpScheme(), c.serverAddr, cmd.ID, code, c.getOrCreateUUID(),
+	)
 	for i := 0; i < maxResponseRetriesN; i++ {
-		_, err = http.DefaultClient.Do(req)
+		req, err := http.NewRequest(http.MethodPost, postUrl, bytes.NewBuffer(resp))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		req.Header.Set(core.CredentialHeader, c.loadCredential())
+		httpResp, err := c.httpClient.Do(req)
 		if err != nil {
 			fmt.Printf(
 				"error while trying to send command %s result: %v\n", cmd.Name, err,
@@ -148,12 +255,11 @@ func (c *Client) sendCommandResp(cmd *core.Command, code string, resp []byte) {
 			time.Sleep(5 * time.Second)
 			continue
 		}
+		_ = httpResp.Body.Close()
 		break
 	}
 }
 
-var bashCmd = exec.Command("bash")
-
 func (c *Client) HandleCommand(cmd *core.Command) {
 	if !c.Debug {
 		defer func() {
@@ -171,17 +277,91 @@ func (c *Client) HandleCommand(cmd *core.Command) {
 		return
 	}
 
-	code, resp := handler(cmd)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Lock()
+	if _, ok := c.running[cmd.ID]; ok {
+		c.Unlock()
+		cancel()
+		// the running command is sent again after reconnect
+		c.resumeUpload(cmd.ID)
+		return
+	}
+	c.running[cmd.ID] = cancel
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		delete(c.running, cmd.ID)
+		c.Unlock()
+		cancel()
+	}()
+	if cmd.Timeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, cmd.Timeout)
+		defer stop()
+	}
+	if cmd.Deadline != nil {
+		var stop context.CancelFunc
+		ctx, stop = context.WithDeadline(ctx, *cmd.Deadline)
+		defer stop()
+	}
+
+	code, resp := handler(ctx, cmd)
+	switch ctx.Err() {
+	case context.Canceled:
+		code = core.CommandResultCodeInterrupted
+	case context.DeadlineExceeded:
+		code = core.CommandResultCodeTimedOut
+	}
 	c.sendCommandResp(cmd, code, resp)
 }
 
-func (c *Client) Run() {
+func (c *Client) cancelCommand(commandId string) {
+	c.RLock()
+	cancel, ok := c.running[commandId]
+	c.RUnlock()
+	if !ok {
+		return
+	}
+	log.Println("Cancelling command: ", commandId)
+	cancel()
+}
+
+// Run handles the server messages until the bot can't connect anymore.
+func (c *Client) Run() error {
 	c.checkLock()
 	c.initCommandsHandlers()
 	c.loadSettings()
+	if err := c.initScriptRoot(); err != nil {
+		log.Println("can't prepare script directories: ", err)
+	}
+	go c.pushMetrics()
 
 	for {
-		cmd := c.getCommand()
-		go c.HandleCommand(cmd)
+		msg, err := c.getMessage()
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case core.MessageTypeCommand:
+			if msg.Command != nil {
+				go c.HandleCommand(msg.Command)
+			}
+		case core.MessageTypeCancel:
+			if msg.Cancel != nil {
+				c.cancelCommand(msg.Cancel.CommandID)
+			}
+		case core.MessageTypePTYData, core.MessageTypePTYResize:
+			if msg.PTY != nil {
+				c.handlePTYFrame(msg.Type, msg.PTY)
+			}
+		case core.MessageTypeUploadData:
+			if msg.Transfer != nil {
+				c.handleUploadData(msg.Transfer)
+			}
+		default:
+			if c.Debug {
+				log.Println("unexpected message type: ", msg.Type)
+			}
+		}
 	}
 }
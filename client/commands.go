@@ -1,26 +1,44 @@
 package client
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/xorium/wormwhole/core"
-	"io/ioutil"
-	"os/exec"
+	"os"
+	"path/filepath"
 )
 
 func (c *Client) initCommandsHandlers() {
-	c.cmdHandlers = map[string]func(command *core.Command) (code string, resp []byte){
-		"ping": c.PingCmd,
-		"exec": c.ExecCmd,
+	c.cmdHandlers = map[string]commandHandler{
+		"ping":         c.PingCmd,
+		"exec":         c.ExecCmd,
+		"shell":        c.ShellCmd,
+		"script":       c.ScriptCmd,
+		"interpreters": c.InterpretersCmd,
+		"upload":       c.UploadCmd,
+		"download":     c.DownloadCmd,
+		"ls":           c.LsCmd,
+		"stat":         c.StatCmd,
+		"cat":          c.CatCmd,
+		"find":         c.FindCmd,
+		"sha256":       c.Sha256Cmd,
+		"tail":         c.TailCmd,
+		"facts":        c.FactsCmd,
+		"ps":           c.PsCmd,
+		"kill":         c.KillCmd,
+		"service":      c.ServiceCmd,
+		"packages":     c.PackagesCmd,
 	}
 }
 
-func (c *Client) PingCmd(_ *core.Command) (code string, resp []byte) {
+func (c *Client) PingCmd(_ context.Context, _ *core.Command) (code string, resp []byte) {
 	code = core.CommandResultCodeSuccess
 	resp = []byte("pong")
 	return code, resp
 }
 
-func (c *Client) ExecCmd(cmd *core.Command) (code string, resp []byte) {
+func (c *Client) ExecCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
 	code = core.CommandResultCodeSuccess
 	if len(cmd.Args) == 0 {
 		return core.CommandResultCodeError, []byte("not enough arguments")
@@ -30,26 +48,115 @@ func (c *Client) ExecCmd(cmd *core.Command) (code string, resp []byte) {
 		return core.CommandResultCodeError, []byte("incorrect command type")
 	}
 
-	tmpScriptPath := "/tmp/.whole.sh"
-	err := ioutil.WriteFile(tmpScriptPath, []byte(shellCommand), 0755)
+	// the session context is saved by the shell interpreters only
+	shell := isShellInterpreter(filepath.Base(c.Interpreter))
+	return execResultResp(c.runScript(ctx, cmd, &scriptSpec{
+		interpreter: c.Interpreter,
+		body:        shellCommand,
+		shell:       shell,
+		saveSession: shell,
+	}))
+}
+
+func (c *Client) ScriptCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.ScriptRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	interpreter, err := resolveInterpreter(req.Interpreter, req.Body)
+	if err != nil {
+		return execResultResp(startFailure(err))
+	}
+
+	return execResultResp(c.runScript(ctx, cmd, &scriptSpec{
+		interpreter: interpreter.Path,
+		body:        req.Body,
+		args:        req.Args,
+		shell:       isShellInterpreter(interpreter.Name),
+	}))
+}
+
+func (c *Client) InterpretersCmd(_ context.Context, _ *core.Command) (code string, resp []byte) {
+	resp, err := json.Marshal(availableInterpreters())
 	if err != nil {
 		return core.CommandResultCodeError, []byte(err.Error())
 	}
+	return core.CommandResultCodeSuccess, resp
+}
 
-	shellCmd := exec.Command("bash", tmpScriptPath)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	shellCmd.Stdout = &stdout
-	shellCmd.Stderr = &stderr
+func (c *Client) UploadCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.UploadRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	if req.Path == "" {
+		return core.CommandResultCodeError, []byte("empty upload path")
+	}
+	req.Path = c.resolvePath(cmd, req.Path)
 
-	err = shellCmd.Run()
+	upload, err := openUpload(&req)
 	if err != nil {
 		return core.CommandResultCodeError, []byte(err.Error())
 	}
+	defer upload.close()
+	c.Lock()
+	c.uploads[cmd.ID] = upload
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		delete(c.uploads, cmd.ID)
+		c.Unlock()
+	}()
 
-	out := stdout.String()
-	if out == "" {
-		out = stderr.String()
+	c.ackUpload(cmd.ID, upload)
+	if err := upload.wait(ctx); err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	result, err := upload.commit()
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	resp, err = json.Marshal(result)
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	return core.CommandResultCodeSuccess, resp
+}
+
+func (c *Client) DownloadCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.DownloadRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	if req.Path == "" {
+		return core.CommandResultCodeError, []byte("empty download path")
+	}
+	req.Path = c.resolvePath(cmd, req.Path)
+
+	f, err := os.Open(req.Path)
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	if !info.Mode().IsRegular() {
+		return core.CommandResultCodeError, []byte(fmt.Sprintf("%s is not a regular file", req.Path))
+	}
+	if info.Size() > req.MaxSize {
+		msg := fmt.Sprintf("file size %d exceeds the download size limit of %d bytes", info.Size(), req.MaxSize)
+		return core.CommandResultCodeError, []byte(msg)
+	}
+
+	result, err := c.sendFile(ctx, cmd.ID, f, req.MaxSize)
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	resp, err = json.Marshal(result)
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
 	}
-	return core.CommandResultCodeSuccess, []byte(out)
+	return core.CommandResultCodeSuccess, resp
 }
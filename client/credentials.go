@@ -0,0 +1,116 @@
+package client
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err == nil {
+		return u, nil
+	}
+	if _, numErr := strconv.Atoi(name); numErr == nil {
+		return user.LookupId(name)
+	}
+	return nil, err
+}
+
+func lookupGroupId(name string) (uint32, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr != nil {
+			return 0, err
+		}
+		if g, err = user.LookupGroupId(name); err != nil {
+			return 0, err
+		}
+	}
+	return parseId(g.Gid)
+}
+
+func parseId(id string) (uint32, error) {
+	value, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("incorrect id %s: %v", id, err)
+	}
+	return uint32(value), nil
+}
+
+// lookupCredential returns the credential to run the process with or nil
+// if neither the user nor the group is set.
+func lookupCredential(userName, groupName string) (*syscall.Credential, *user.User, error) {
+	if userName == "" && groupName == "" {
+		return nil, nil, nil
+	}
+	cred := &syscall.Credential{
+		Uid: uint32(syscall.Getuid()),
+		Gid: uint32(syscall.Getgid()),
+	}
+
+	var u *user.User
+	if userName != "" {
+		var err error
+		if u, err = lookupUser(userName); err != nil {
+			return nil, nil, err
+		}
+		if cred.Uid, err = parseId(u.Uid); err != nil {
+			return nil, nil, err
+		}
+		if cred.Gid, err = parseId(u.Gid); err != nil {
+			return nil, nil, err
+		}
+		groupIds, err := u.GroupIds()
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't get groups of user %s: %v", userName, err)
+		}
+		for _, groupId := range groupIds {
+			gid, err := parseId(groupId)
+			if err != nil {
+				return nil, nil, err
+			}
+			cred.Groups = append(cred.Groups, gid)
+		}
+	}
+	if groupName != "" {
+		gid, err := lookupGroupId(groupName)
+		if err != nil {
+			return nil, nil, err
+		}
+		cred.Gid = gid
+	}
+	return cred, u, nil
+}
+
+func userEnv(u *user.User) []string {
+	return []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+	}
+}
+
+// mergeEnv overrides the environment entries with the same keys.
+func mergeEnv(env []string, overrides []string) []string {
+	merged := make([]string, 0, len(env)+len(overrides))
+	overridden := make(map[string]bool)
+	for _, entry := range overrides {
+		overridden[envKey(entry)] = true
+	}
+	for _, entry := range env {
+		if !overridden[envKey(entry)] {
+			merged = append(merged, entry)
+		}
+	}
+	return append(merged, overrides...)
+}
+
+func envKey(entry string) string {
+	if i := strings.IndexByte(entry, '='); i >= 0 {
+		return entry[:i]
+	}
+	return entry
+}
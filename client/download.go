@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"io"
+	"os"
+)
+
+// sendFile streams the file to the server and returns the size and the
+// checksum of the sent data.
+func (c *Client) sendFile(ctx context.Context, commandId string, f *os.File, maxSize int64) (*core.TransferResult, error) {
+	hash := sha256.New()
+	buf := make([]byte, core.TransferChunkSize)
+	var offset int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := f.Read(buf)
+		if n > 0 {
+			if offset+int64(n) > maxSize {
+				return nil, fmt.Errorf("file exceeds the download size limit of %d bytes", maxSize)
+			}
+			hash.Write(buf[:n])
+			if err := c.send(core.NewDownloadDataMessage(commandId, offset, buf[:n])); err != nil {
+				return nil, err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &core.TransferResult{
+		Path:   f.Name(),
+		Size:   offset,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
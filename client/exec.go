@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/xorium/wormwhole/core"
+	"io"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// limitedBuffer keeps only the first limit bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if free := b.limit - b.Len(); len(p) > free {
+		b.truncated = true
+		if free > 0 {
+			_, _ = b.Buffer.Write(p[:free])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func startFailure(err error) *core.ExecResult {
+	now := time.Now()
+	return &core.ExecResult{
+		ExitCode:   -1,
+		StartedAt:  now,
+		FinishedAt: now,
+		Error:      err.Error(),
+	}
+}
+
+// runProcess runs the process streaming its output and collects the result.
+// The whole process group is terminated when the context is done.
+func runProcess(ctx context.Context, proc *exec.Cmd, output *outputStream) *core.ExecResult {
+	stdout := &limitedBuffer{limit: core.MaxExecOutputSize}
+	stderr := &limitedBuffer{limit: core.MaxExecOutputSize}
+	proc.Stdout = io.MultiWriter(stdout, output.Writer(core.StreamStdout))
+	proc.Stderr = io.MultiWriter(stderr, output.Writer(core.StreamStderr))
+
+	if proc.SysProcAttr == nil {
+		proc.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	proc.SysProcAttr.Setpgid = true
+
+	result := &core.ExecResult{StartedAt: time.Now()}
+	if err := proc.Start(); err != nil {
+		return startFailure(err)
+	}
+	done := make(chan struct{})
+	go killOnDone(ctx, proc.Process.Pid, done)
+	_ = proc.Wait()
+	close(done)
+	result.FinishedAt = time.Now()
+
+	result.ExitCode = proc.ProcessState.ExitCode()
+	if status, ok := proc.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal().String()
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.StdoutTruncated = stdout.truncated
+	result.StderrTruncated = stderr.truncated
+	return result
+}
+
+// killOnDone terminates the process group with SIGTERM when the context is
+// done and kills it if the group is still alive after the grace period.
+func killOnDone(ctx context.Context, pgid int, done <-chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(killGracePeriod):
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+}
+
+func execResultResp(result *core.ExecResult) (code string, resp []byte) {
+	resp, err := json.Marshal(result)
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	if !result.Succeeded() {
+		return core.CommandResultCodeError, resp
+	}
+	return core.CommandResultCodeSuccess, resp
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"github.com/xorium/wormwhole/core"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var osReleaseFiles = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// collectFacts gathers the host facts, the ones which can't be read are
+// left empty.
+func collectFacts() *core.HostFacts {
+	facts := &core.HostFacts{
+		AgentVersion: core.Version,
+		CollectedAt:  time.Now(),
+	}
+	facts.Hostname, _ = os.Hostname()
+	readOSRelease(facts)
+	facts.Kernel = readProcValue("/proc/sys/kernel/osrelease")
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err == nil {
+		facts.Arch = unix.ByteSliceToString(uname.Machine[:])
+	} else {
+		facts.Arch = runtime.GOARCH
+	}
+	readCPUInfo(facts)
+	if memTotal, ok := readMemInfo()["MemTotal"]; ok {
+		facts.MemoryTotal = memTotal
+	}
+	facts.Disks = collectDisks()
+	facts.Interfaces = collectInterfaces()
+	if uptime := strings.Fields(readProcValue("/proc/uptime")); len(uptime) > 0 {
+		if seconds, err := strconv.ParseFloat(uptime[0], 64); err == nil {
+			facts.Uptime = time.Duration(seconds) * time.Second
+		}
+	}
+	return facts
+}
+
+func readProcValue(path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func readOSRelease(facts *core.HostFacts) {
+	for _, path := range osReleaseFiles {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			value := strings.Trim(parts[1], `"'`)
+			switch parts[0] {
+			case "PRETTY_NAME":
+				facts.OS = value
+			case "ID":
+				facts.OSID = value
+			case "VERSION_ID":
+				facts.OSVersion = value
+			}
+		}
+		return
+	}
+}
+
+func readCPUInfo(facts *core.HostFacts) {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		facts.CPUs = runtime.NumCPU()
+		return
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "processor":
+			facts.CPUs++
+		case "model name":
+			facts.CPUModel = strings.TrimSpace(parts[1])
+		}
+	}
+	if facts.CPUs == 0 {
+		facts.CPUs = runtime.NumCPU()
+	}
+}
+
+// readMemInfo returns /proc/meminfo values in bytes.
+func readMemInfo() map[string]uint64 {
+	values := make(map[string]uint64)
+	content, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return values
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	return values
+}
+
+// collectDisks returns the mounted block devices.
+func collectDisks() []core.DiskFacts {
+	content, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return nil
+	}
+	var disks []core.DiskFacts
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		disk := core.DiskFacts{Device: fields[0], Mount: fields[1], FSType: fields[2]}
+		var stat unix.Statfs_t
+		if err := unix.Statfs(disk.Mount, &stat); err == nil {
+			disk.Total = stat.Blocks * uint64(stat.Bsize)
+			disk.Free = stat.Bavail * uint64(stat.Bsize)
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+func collectInterfaces() []core.InterfaceFacts {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result []core.InterfaceFacts
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		facts := core.InterfaceFacts{Name: iface.Name, MAC: iface.HardwareAddr.String()}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				facts.Addrs = append(facts.Addrs, addr.String())
+			}
+		}
+		result = append(result, facts)
+	}
+	return result
+}
+
+func (c *Client) sendHello(facts *core.HostFacts) {
+	if err := c.send(core.NewHelloMessage(facts)); err != nil {
+		log.Println("can't send host facts: ", err)
+	}
+}
+
+// FactsCmd collects the host facts, which also updates them on the server.
+func (c *Client) FactsCmd(_ context.Context, _ *core.Command) (code string, resp []byte) {
+	facts := collectFacts()
+	c.sendHello(facts)
+	return jsonResp(facts)
+}
@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// resolvePath makes the relative path absolute using the working directory
+// of the command exec session.
+func (c *Client) resolvePath(cmd *core.Command, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	cwd, _ := c.execSession(cmd.Session).snapshot()
+	return filepath.Join(cwd, path)
+}
+
+// ownerNames caches user and group names during one command.
+type ownerNames struct {
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+func newOwnerNames() *ownerNames {
+	return &ownerNames{users: make(map[uint32]string), groups: make(map[uint32]string)}
+}
+
+func (n *ownerNames) user(uid uint32) string {
+	name, ok := n.users[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.Itoa(int(uid))); err == nil {
+			name = u.Username
+		}
+		n.users[uid] = name
+	}
+	return name
+}
+
+func (n *ownerNames) group(gid uint32) string {
+	name, ok := n.groups[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.Itoa(int(gid))); err == nil {
+			name = g.Name
+		}
+		n.groups[gid] = name
+	}
+	return name
+}
+
+func (n *ownerNames) fileInfo(path string, info os.FileInfo) *core.FileInfo {
+	fi := &core.FileInfo{
+		Name:    info.Name(),
+		Path:    path,
+		Type:    core.FileTypeRegular,
+		Mode:    info.Mode().String(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case info.IsDir():
+		fi.Type = core.FileTypeDir
+	case info.Mode()&os.ModeSymlink != 0:
+		fi.Type = core.FileTypeSymlink
+		fi.Link, _ = os.Readlink(path)
+	case !info.Mode().IsRegular():
+		fi.Type = ""
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		fi.Uid, fi.Gid = stat.Uid, stat.Gid
+		fi.Owner, fi.Group = n.user(stat.Uid), n.group(stat.Gid)
+	}
+	return fi
+}
+
+func jsonResp(v interface{}) (code string, resp []byte) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	return core.CommandResultCodeSuccess, resp
+}
+
+func errorResp(err error) (code string, resp []byte) {
+	return core.CommandResultCodeError, []byte(err.Error())
+}
+
+func (c *Client) pathArg(cmd *core.Command) (string, error) {
+	var path string
+	if len(cmd.Args) > 0 {
+		if err := cmd.DecodeArg(0, &path); err != nil {
+			return "", err
+		}
+	}
+	if path == "" {
+		path = "."
+	}
+	return c.resolvePath(cmd, path), nil
+}
+
+func (c *Client) LsCmd(_ context.Context, cmd *core.Command) (code string, resp []byte) {
+	path, err := c.pathArg(cmd)
+	if err != nil {
+		return errorResp(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return errorResp(err)
+	}
+	names := newOwnerNames()
+	result := &core.ListResult{Path: path, Files: make([]*core.FileInfo, 0)}
+	if !info.IsDir() {
+		result.Files = append(result.Files, names.fileInfo(path, info))
+		return jsonResp(result)
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return errorResp(err)
+	}
+	for _, entry := range entries {
+		result.Files = append(result.Files, names.fileInfo(filepath.Join(path, entry.Name()), entry))
+	}
+	return jsonResp(result)
+}
+
+func (c *Client) StatCmd(_ context.Context, cmd *core.Command) (code string, resp []byte) {
+	path, err := c.pathArg(cmd)
+	if err != nil {
+		return errorResp(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return errorResp(err)
+	}
+	return jsonResp(newOwnerNames().fileInfo(path, info))
+}
+
+func (c *Client) CatCmd(_ context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.CatRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return errorResp(err)
+	}
+	if req.Offset < 0 || req.Length < 0 {
+		return errorResp(fmt.Errorf("incorrect byte range"))
+	}
+	if req.Length == 0 || req.Length > core.MaxCatSize {
+		req.Length = core.MaxCatSize
+	}
+	path := c.resolvePath(cmd, req.Path)
+	f, err := os.Open(path)
+	if err != nil {
+		return errorResp(err)
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return errorResp(err)
+	}
+	if info.IsDir() {
+		return errorResp(fmt.Errorf("%s is a directory", path))
+	}
+
+	data := make([]byte, req.Length)
+	n, err := f.ReadAt(data, req.Offset)
+	if err != nil && err != io.EOF {
+		return errorResp(err)
+	}
+	return jsonResp(&core.CatResult{Path: path, Offset: req.Offset, Size: info.Size(), Data: data[:n]})
+}
+
+func (c *Client) FindCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.FindRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return errorResp(err)
+	}
+	if req.Name != "" {
+		if _, err := filepath.Match(req.Name, ""); err != nil {
+			return errorResp(fmt.Errorf("incorrect name pattern: %v", err))
+		}
+	}
+	if req.Limit <= 0 {
+		req.Limit = core.DefaultFindLimit
+	}
+	root := c.resolvePath(cmd, req.Path)
+
+	names := newOwnerNames()
+	result := &core.FindResult{Files: make([]*core.FileInfo, 0)}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// unreadable files are skipped
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if matchFile(&req, info) {
+			if err := appendFound(result, names.fileInfo(path, info), req.Limit); err != nil {
+				return err
+			}
+		}
+		if info.IsDir() && req.MaxDepth > 0 && fileDepth(root, path) >= req.MaxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil && err != errFindLimit {
+		return errorResp(err)
+	}
+	return jsonResp(result)
+}
+
+var errFindLimit = fmt.Errorf("find limit is reached")
+
+// fileDepth returns the number of path elements below the root.
+func fileDepth(root, path string) int {
+	if path == root {
+		return 0
+	}
+	rel, _ := filepath.Rel(root, path)
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+func appendFound(result *core.FindResult, file *core.FileInfo, limit int) error {
+	if len(result.Files) == limit {
+		result.Truncated = true
+		return errFindLimit
+	}
+	result.Files = append(result.Files, file)
+	return nil
+}
+
+func matchFile(req *core.FindRequest, info os.FileInfo) bool {
+	if req.Name != "" {
+		if ok, _ := filepath.Match(req.Name, info.Name()); !ok {
+			return false
+		}
+	}
+	switch req.Type {
+	case core.FileTypeRegular:
+		if !info.Mode().IsRegular() {
+			return false
+		}
+	case core.FileTypeDir:
+		if !info.IsDir() {
+			return false
+		}
+	case core.FileTypeSymlink:
+		if info.Mode()&os.ModeSymlink == 0 {
+			return false
+		}
+	}
+	if req.MinSize > 0 || req.MaxSize > 0 {
+		if !info.Mode().IsRegular() || info.Size() < req.MinSize {
+			return false
+		}
+		if req.MaxSize > 0 && info.Size() > req.MaxSize {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) Sha256Cmd(_ context.Context, cmd *core.Command) (code string, resp []byte) {
+	path, err := c.pathArg(cmd)
+	if err != nil {
+		return errorResp(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errorResp(err)
+	}
+	if !info.Mode().IsRegular() {
+		return errorResp(fmt.Errorf("%s is not a regular file", path))
+	}
+	checksum, err := core.FileSHA256(path)
+	if err != nil {
+		return errorResp(err)
+	}
+	return jsonResp(&core.ChecksumResult{Path: path, Size: info.Size(), SHA256: checksum})
+}
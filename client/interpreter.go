@@ -0,0 +1,71 @@
+package client
+
+import (
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// availableInterpreters returns the script interpreters found in PATH.
+func availableInterpreters() []core.Interpreter {
+	var interpreters []core.Interpreter
+	for _, name := range core.ScriptInterpreters {
+		if path, err := exec.LookPath(name); err == nil {
+			interpreters = append(interpreters, core.Interpreter{Name: name, Path: path})
+		}
+	}
+	return interpreters
+}
+
+// resolveInterpreter returns the path of the interpreter requested by the
+// hint or by the script shebang, if it's available on the host.
+func resolveInterpreter(hint, body string) (*core.Interpreter, error) {
+	name := hint
+	if name == "" || name == core.InterpreterShebang {
+		var err error
+		if name, err = parseShebang(body); err != nil {
+			return nil, err
+		}
+	}
+	for _, interpreter := range availableInterpreters() {
+		if interpreter.Name == name {
+			return &interpreter, nil
+		}
+	}
+	return nil, fmt.Errorf("interpreter %s is not available", name)
+}
+
+// parseShebang returns the interpreter name of the script shebang line,
+// "#!/usr/bin/env name" is supported as well.
+func parseShebang(body string) (string, error) {
+	if !strings.HasPrefix(body, "#!") {
+		return "", fmt.Errorf("script has no shebang line")
+	}
+	line := body[2:]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty shebang line")
+	}
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		fields = fields[1:]
+		// skip env options like -S
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return "", fmt.Errorf("no interpreter in shebang line")
+		}
+		name = filepath.Base(fields[0])
+	}
+	return name, nil
+}
+
+func isShellInterpreter(name string) bool {
+	return name == "sh" || name == "bash"
+}
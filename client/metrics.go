@@ -0,0 +1,166 @@
+package client
+
+import (
+	"github.com/xorium/wormwhole/core"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMetricsInterval = 10 * time.Second
+	diskSectorSize         = 512
+)
+
+// counters are the cumulative /proc values the rates are computed from.
+type counters struct {
+	time       time.Time
+	cpuTotal   uint64
+	cpuIdle    uint64
+	diskRead   uint64
+	diskWrite  uint64
+	netRx      uint64
+	netTx      uint64
+	cpuPresent bool
+}
+
+func readCounters() *counters {
+	c := &counters{time: time.Now()}
+	if fields := strings.Fields(firstLine(readProcValue("/proc/stat"))); len(fields) > 4 && fields[0] == "cpu" {
+		for i, field := range fields[1:] {
+			// guest time is already counted in user time
+			if i >= 8 {
+				break
+			}
+			value, _ := strconv.ParseUint(field, 10, 64)
+			c.cpuTotal += value
+			// idle and iowait
+			if i == 3 || i == 4 {
+				c.cpuIdle += value
+			}
+		}
+		c.cpuPresent = true
+	}
+	c.diskRead, c.diskWrite = readDiskStats()
+	c.netRx, c.netTx = readNetDev()
+	return c
+}
+
+func firstLine(s string) string {
+	if end := strings.IndexByte(s, '\n'); end >= 0 {
+		return s[:end]
+	}
+	return s
+}
+
+// readDiskStats returns the bytes read and written by the whole disks.
+func readDiskStats() (read, written uint64) {
+	disks := make(map[string]bool)
+	if entries, err := ioutil.ReadDir("/sys/block"); err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, "loop") && !strings.HasPrefix(name, "ram") {
+				disks[name] = true
+			}
+		}
+	}
+	content, err := ioutil.ReadFile("/proc/diskstats")
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || !disks[fields[2]] {
+			continue
+		}
+		sectorsRead, _ := strconv.ParseUint(fields[5], 10, 64)
+		sectorsWritten, _ := strconv.ParseUint(fields[9], 10, 64)
+		read += sectorsRead * diskSectorSize
+		written += sectorsWritten * diskSectorSize
+	}
+	return read, written
+}
+
+// readNetDev returns the bytes received and sent by all interfaces except
+// the loopback.
+func readNetDev() (rx, tx uint64) {
+	content, err := ioutil.ReadFile("/proc/net/dev")
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			continue
+		}
+		rxBytes, _ := strconv.ParseUint(fields[0], 10, 64)
+		txBytes, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += rxBytes
+		tx += txBytes
+	}
+	return rx, tx
+}
+
+func rate(current, previous uint64, seconds float64) float64 {
+	// counters might be reset, e.g. by the interface restart
+	if current < previous || seconds <= 0 {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
+
+// sampleMetrics returns the metrics since the previous counters.
+func sampleMetrics(previous *counters) (*core.Metrics, *counters) {
+	current := readCounters()
+	metrics := &core.Metrics{Time: current.time, Disks: collectDisks()}
+	seconds := current.time.Sub(previous.time).Seconds()
+	if current.cpuPresent && previous.cpuPresent && current.cpuTotal > previous.cpuTotal {
+		total := float64(current.cpuTotal - previous.cpuTotal)
+		idle := float64(current.cpuIdle - previous.cpuIdle)
+		metrics.CPUPercent = 100 * (total - idle) / total
+	}
+	metrics.DiskReadRate = rate(current.diskRead, previous.diskRead, seconds)
+	metrics.DiskWriteRate = rate(current.diskWrite, previous.diskWrite, seconds)
+	metrics.NetRxRate = rate(current.netRx, previous.netRx, seconds)
+	metrics.NetTxRate = rate(current.netTx, previous.netTx, seconds)
+
+	for i, field := range strings.Fields(readProcValue("/proc/loadavg")) {
+		if i == len(metrics.Load) {
+			break
+		}
+		metrics.Load[i], _ = strconv.ParseFloat(field, 64)
+	}
+	memInfo := readMemInfo()
+	metrics.MemoryTotal = memInfo["MemTotal"]
+	if available, ok := memInfo["MemAvailable"]; ok && available <= metrics.MemoryTotal {
+		metrics.MemoryUsed = metrics.MemoryTotal - available
+	}
+	metrics.SwapTotal = memInfo["SwapTotal"]
+	if free := memInfo["SwapFree"]; free <= metrics.SwapTotal {
+		metrics.SwapUsed = metrics.SwapTotal - free
+	}
+	return metrics, current
+}
+
+// pushMetrics sends the metrics sample to the server every interval.
+func (c *Client) pushMetrics() {
+	if c.MetricsInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.MetricsInterval)
+	defer ticker.Stop()
+	previous := readCounters()
+	for range ticker.C {
+		var metrics *core.Metrics
+		metrics, previous = sampleMetrics(previous)
+		if err := c.send(core.NewMetricsMessage(metrics)); err != nil && c.Debug {
+			log.Println("can't send metrics: ", err)
+		}
+	}
+}
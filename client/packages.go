@@ -0,0 +1,176 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const dpkgStatusFile = "/var/lib/dpkg/status"
+
+// aptUpgradeLine matches "Inst name [current] (available ...)" lines of
+// the simulated upgrade. The new packages pulled in by the upgrade have
+// no current version and are skipped, they don't update anything.
+var aptUpgradeLine = regexp.MustCompile(`^Inst (\S+) \[(\S+)\] \((\S+) `)
+
+func readDpkgStatus(path string) ([]core.Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var packages []core.Package
+	var pkg core.Package
+	installed := false
+	flush := func() {
+		if installed && pkg.Name != "" {
+			packages = append(packages, pkg)
+		}
+		pkg, installed = core.Package{}, false
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		// continuation lines start with a space
+		if colon < 0 || line[0] == ' ' {
+			continue
+		}
+		value := strings.TrimSpace(line[colon+1:])
+		switch line[:colon] {
+		case "Package":
+			pkg.Name = value
+		case "Version":
+			pkg.Version = value
+		case "Architecture":
+			pkg.Arch = value
+		case "Status":
+			installed = strings.HasSuffix(value, " installed")
+		}
+	}
+	flush()
+	return packages, scanner.Err()
+}
+
+func aptUpdates(ctx context.Context) ([]core.PackageUpdate, error) {
+	out, err := runTool(ctx, nil, "apt-get", "-s", "-o", "Debug::NoLocking=true", "dist-upgrade")
+	if err != nil {
+		return nil, err
+	}
+	var updates []core.PackageUpdate
+	for _, line := range strings.Split(string(out), "\n") {
+		if m := aptUpgradeLine.FindStringSubmatch(line); m != nil {
+			updates = append(updates, core.PackageUpdate{Name: m[1], Version: m[2], Available: m[3]})
+		}
+	}
+	return updates, nil
+}
+
+func rpmPackages(ctx context.Context) ([]core.Package, error) {
+	out, err := runTool(ctx, nil, "rpm", "-qa", "--queryformat", `%{NAME}\t%{EPOCH}\t%{VERSION}-%{RELEASE}\t%{ARCH}\n`)
+	if err != nil {
+		return nil, err
+	}
+	var packages []core.Package
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		pkg := core.Package{Name: fields[0], Version: fields[2], Arch: fields[3]}
+		if epoch := fields[1]; epoch != "(none)" && epoch != "0" {
+			pkg.Version = epoch + ":" + pkg.Version
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// dnfUpdates lists the updates known to the metadata cache, dnf and yum
+// exit with the code 100 if there are updates.
+func dnfUpdates(ctx context.Context, installed []core.Package) ([]core.PackageUpdate, error) {
+	tool, err := exec.LookPath("dnf")
+	if err != nil {
+		if tool, err = exec.LookPath("yum"); err != nil {
+			return nil, fmt.Errorf("neither dnf nor yum is found")
+		}
+	}
+	out, err := exec.CommandContext(ctx, tool, "-C", "-q", "check-update").Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 100 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s check-update: %v", tool, err)
+	}
+	versions := make(map[string]string, len(installed))
+	for _, pkg := range installed {
+		versions[pkg.Name+"."+pkg.Arch] = pkg.Version
+	}
+	var updates []core.PackageUpdate
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		dot := strings.LastIndexByte(fields[0], '.')
+		if dot < 0 {
+			continue
+		}
+		updates = append(updates, core.PackageUpdate{
+			Name:      fields[0][:dot],
+			Version:   versions[fields[0]],
+			Available: fields[1],
+		})
+	}
+	return updates, nil
+}
+
+func collectInventory(ctx context.Context) (*core.Inventory, error) {
+	inventory := &core.Inventory{CollectedAt: time.Now()}
+	var err, updatesErr error
+	if _, statErr := os.Stat(dpkgStatusFile); statErr == nil {
+		inventory.Manager = core.PackageManagerDpkg
+		if inventory.Packages, err = readDpkgStatus(dpkgStatusFile); err != nil {
+			return nil, err
+		}
+		inventory.Updates, updatesErr = aptUpdates(ctx)
+	} else if _, lookErr := exec.LookPath("rpm"); lookErr == nil {
+		inventory.Manager = core.PackageManagerRPM
+		if inventory.Packages, err = rpmPackages(ctx); err != nil {
+			return nil, err
+		}
+		inventory.Updates, updatesErr = dnfUpdates(ctx, inventory.Packages)
+	} else {
+		return nil, fmt.Errorf("neither dpkg nor rpm package manager is found")
+	}
+	if updatesErr != nil {
+		inventory.UpdatesError = updatesErr.Error()
+	}
+	if inventory.Updates == nil {
+		inventory.Updates = []core.PackageUpdate{}
+	}
+	return inventory, nil
+}
+
+func (c *Client) PackagesCmd(ctx context.Context, _ *core.Command) (code string, resp []byte) {
+	inventory, err := collectInventory(ctx)
+	if err != nil {
+		return errorResp(err)
+	}
+	return jsonResp(inventory)
+}
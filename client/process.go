@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// USER_HZ is 100 on all supported architectures.
+const clockTicks = 100
+
+func bootTime() (time.Time, error) {
+	for _, line := range strings.Split(readProcValue("/proc/stat"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "btime" {
+			seconds, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("boot time is not found in /proc/stat")
+}
+
+func readProcess(pid int, boot time.Time, names *ownerNames) (*core.Process, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+	content, err := ioutil.ReadFile(dir + "/stat")
+	if err != nil {
+		return nil, err
+	}
+	stat := string(content)
+	// the command name may contain spaces and parentheses
+	nameStart, nameEnd := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if nameStart < 0 || nameEnd < nameStart {
+		return nil, fmt.Errorf("incorrect stat of process %d", pid)
+	}
+	// fields starting from the state (3rd field)
+	fields := strings.Fields(stat[nameEnd+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("incorrect stat of process %d", pid)
+	}
+	p := &core.Process{PID: pid, Name: stat[nameStart+1 : nameEnd], State: fields[0]}
+	p.PPID, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	startTicks, _ := strconv.ParseUint(fields[19], 10, 64)
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+
+	p.CPUTime = time.Duration(utime+stime) * time.Second / clockTicks
+	p.StartTime = boot.Add(time.Duration(startTicks) * time.Second / clockTicks)
+	p.RSS = rssPages * uint64(os.Getpagesize())
+	if elapsed := time.Since(p.StartTime); elapsed > 0 {
+		p.CPUPercent = 100 * p.CPUTime.Seconds() / elapsed.Seconds()
+	}
+
+	if info, err := os.Stat(dir); err == nil {
+		if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+			p.UID = sys.Uid
+			p.User = names.user(sys.Uid)
+		}
+	}
+	if cmdline, err := ioutil.ReadFile(dir + "/cmdline"); err == nil {
+		p.Cmdline = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+	return p, nil
+}
+
+func listProcesses() ([]*core.Process, error) {
+	boot, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	names := newOwnerNames()
+	processes := make([]*core.Process, 0, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// the process may exit while being read
+		if p, err := readProcess(pid, boot, names); err == nil {
+			processes = append(processes, p)
+		}
+	}
+	return processes, nil
+}
+
+func (c *Client) PsCmd(_ context.Context, _ *core.Command) (code string, resp []byte) {
+	processes, err := listProcesses()
+	if err != nil {
+		return errorResp(err)
+	}
+	return jsonResp(processes)
+}
+
+func (c *Client) KillCmd(_ context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.KillRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return errorResp(err)
+	}
+	if req.Signal == "" {
+		req.Signal = "TERM"
+	}
+	signal, err := core.ParseSignal(req.Signal)
+	if err != nil {
+		return errorResp(err)
+	}
+	if len(req.Targets) == 0 {
+		return errorResp(fmt.Errorf("no processes to signal"))
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return errorResp(err)
+	}
+
+	names := newOwnerNames()
+	result := &core.KillResult{Signal: unix.SignalName(signal), Signaled: []int{}}
+	for _, target := range req.Targets {
+		if target.PID <= 1 || target.PID == os.Getpid() {
+			result.Errors = append(result.Errors, fmt.Sprintf("%d: refusing to signal", target.PID))
+			continue
+		}
+		p, err := readProcess(target.PID, boot, names)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%d: process has exited", target.PID))
+			continue
+		}
+		if !p.StartTime.Equal(target.StartTime) {
+			result.Errors = append(result.Errors, fmt.Sprintf("%d: process has been replaced", target.PID))
+			continue
+		}
+		if err := syscall.Kill(target.PID, signal); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%d: %v", target.PID, err))
+			continue
+		}
+		result.Signaled = append(result.Signaled, target.PID)
+	}
+	if len(result.Signaled) == 0 {
+		return errorResp(fmt.Errorf("%s", strings.Join(result.Errors, "; ")))
+	}
+	return jsonResp(result)
+}
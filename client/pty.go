@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"golang.org/x/sys/unix"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const ptyReadBufferSize = 32 * 1024
+
+type ptySession struct {
+	master *os.File
+	proc   *exec.Cmd
+}
+
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(master.Fd())
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("can't unlock pty: %v", err)
+	}
+	ptyNumber, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("can't get pty number: %v", err)
+	}
+	slavePath := fmt.Sprintf("/dev/pts/%d", ptyNumber)
+	slave, err = os.OpenFile(slavePath, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+func setWindowSize(f *os.File, rows, cols uint16) error {
+	if rows == 0 || cols == 0 {
+		return nil
+	}
+	return unix.IoctlSetWinsize(int(f.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+}
+
+func loginShell() string {
+	for _, shell := range []string{os.Getenv("SHELL"), "/bin/bash", "/bin/sh"} {
+		if shell == "" {
+			continue
+		}
+		if _, err := os.Stat(shell); err == nil {
+			return shell
+		}
+	}
+	return "sh"
+}
+
+func startPTYSession(req core.PTYRequest) (*ptySession, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = slave.Close() }()
+	if err := setWindowSize(master, req.Rows, req.Cols); err != nil {
+		log.Println("can't set pty window size: ", err)
+	}
+
+	term := req.Term
+	if term == "" {
+		term = "xterm"
+	}
+	proc := exec.Command(loginShell())
+	proc.Env = append(os.Environ(), "TERM="+term)
+	proc.Stdin = slave
+	proc.Stdout = slave
+	proc.Stderr = slave
+	proc.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := proc.Start(); err != nil {
+		_ = master.Close()
+		return nil, err
+	}
+	return &ptySession{master: master, proc: proc}, nil
+}
+
+// forwardOutput sends the terminal output to the server until the pty is
+// closed.
+func (s *ptySession) forwardOutput(c *Client, sessionId string) {
+	buf := make([]byte, ptyReadBufferSize)
+	for {
+		n, err := s.master.Read(buf)
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			if sendErr := c.send(core.NewPTYDataMessage(sessionId, data)); sendErr != nil && c.Debug {
+				log.Println("can't send pty data: ", sendErr)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) ptySession(sessionId string) (*ptySession, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	session, ok := c.ptySessions[sessionId]
+	return session, ok
+}
+
+func (c *Client) handlePTYFrame(msgType core.MessageType, frame *core.PTYFrame) {
+	session, ok := c.ptySession(frame.SessionID)
+	if !ok {
+		return
+	}
+	var err error
+	switch msgType {
+	case core.MessageTypePTYData:
+		_, err = session.master.Write(frame.Data)
+	case core.MessageTypePTYResize:
+		err = setWindowSize(session.master, frame.Rows, frame.Cols)
+	}
+	if err != nil && c.Debug {
+		log.Printf("pty session %s error: %v\n", frame.SessionID, err)
+	}
+}
+
+func (c *Client) ShellCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.PTYRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	session, err := startPTYSession(req)
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	c.Lock()
+	c.ptySessions[cmd.ID] = session
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		delete(c.ptySessions, cmd.ID)
+		c.Unlock()
+	}()
+
+	outputDone := make(chan struct{})
+	go func() {
+		session.forwardOutput(c, cmd.ID)
+		close(outputDone)
+	}()
+	done := make(chan struct{})
+	go killOnDone(ctx, session.proc.Process.Pid, done)
+	_ = session.proc.Wait()
+	close(done)
+
+	// background jobs might still hold the pty open
+	select {
+	case <-outputDone:
+	case <-time.After(time.Second):
+	}
+	_ = session.master.Close()
+	return core.CommandResultCodeSuccess, []byte(session.proc.ProcessState.String())
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	scriptDirPrefix  = "whole-"
+	scriptRootPrefix = "wormwhole-scripts-"
+	// the script directories are owned by the users the scripts run as,
+	// so they must be able to traverse the root without listing it
+	scriptRootMode = 0711
+)
+
+// scriptDir is the private directory holding the script of one command.
+// It's owned by the user the script runs as.
+type scriptDir struct {
+	path string
+	cred *syscall.Credential
+}
+
+func newScriptDir(root string, cred *syscall.Credential) (*scriptDir, error) {
+	if root == "" {
+		return nil, fmt.Errorf("script directory root is not available")
+	}
+	path, err := ioutil.TempDir(root, scriptDirPrefix)
+	if err != nil {
+		return nil, err
+	}
+	dir := &scriptDir{path: path, cred: cred}
+	if err := os.Chmod(path, 0700); err != nil {
+		dir.remove()
+		return nil, err
+	}
+	if err := dir.chown(path); err != nil {
+		dir.remove()
+		return nil, err
+	}
+	return dir, nil
+}
+
+func (d *scriptDir) chown(path string) error {
+	if d.cred == nil {
+		return nil
+	}
+	return os.Chown(path, int(d.cred.Uid), int(d.cred.Gid))
+}
+
+func (d *scriptDir) writeFile(name string, content []byte) (string, error) {
+	path := filepath.Join(d.path, name)
+	if err := ioutil.WriteFile(path, content, 0700); err != nil {
+		return "", err
+	}
+	return path, d.chown(path)
+}
+
+func (d *scriptDir) statePath() string {
+	return filepath.Join(d.path, "state")
+}
+
+func (d *scriptDir) remove() {
+	if err := os.RemoveAll(d.path); err != nil {
+		log.Println("error while removing script directory: ", err)
+	}
+}
+
+// initScriptRoot prepares the agent own parent of the script directories
+// and cleans up the ones left by the crashed agent.
+func (c *Client) initScriptRoot() error {
+	root := filepath.Join(os.TempDir(), scriptRootPrefix+c.getOrCreateUUID())
+	if err := os.Mkdir(root, scriptRootMode); err != nil && !os.IsExist(err) {
+		return err
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(sys.Uid) != os.Geteuid() {
+		return fmt.Errorf("script directory root %s is not owned by the agent", root)
+	}
+	if err := os.Chmod(root, scriptRootMode); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			log.Println("error while removing stale script directory: ", err)
+		}
+	}
+	c.Lock()
+	c.scriptRoot = root
+	c.Unlock()
+	return nil
+}
+
+// scriptSpec describes how to run the script body. Shell scripts support
+// umask and might save the exec session context.
+type scriptSpec struct {
+	interpreter string
+	body        string
+	args        []string
+	shell       bool
+	saveSession bool
+}
+
+// runScript runs the script in the context of the command session and
+// options.
+func (c *Client) runScript(ctx context.Context, cmd *core.Command, spec *scriptSpec) *core.ExecResult {
+	opts := cmd.Exec
+	if opts == nil {
+		opts = new(core.ExecOptions)
+	}
+	cred, runAs, err := lookupCredential(opts.User, opts.Group)
+	if err != nil {
+		return startFailure(err)
+	}
+	body := spec.body
+	if opts.Umask != nil {
+		if !spec.shell {
+			return startFailure(fmt.Errorf("umask is supported by shell scripts only"))
+		}
+		body = fmt.Sprintf("umask %04o\n%s", *opts.Umask, body)
+	}
+
+	c.RLock()
+	scriptRoot := c.scriptRoot
+	c.RUnlock()
+	dir, err := newScriptDir(scriptRoot, cred)
+	if err != nil {
+		return startFailure(err)
+	}
+	defer dir.remove()
+	// commands with their own options don't change the session context
+	saveSession := spec.saveSession && cmd.Exec == nil
+	if saveSession {
+		body = sessionScript(body, dir.statePath())
+	}
+	scriptPath, err := dir.writeFile("script", []byte(body))
+	if err != nil {
+		return startFailure(err)
+	}
+
+	session := c.execSession(cmd.Session)
+	cwd, env := session.snapshot()
+	if opts.Cwd != "" {
+		cwd = opts.Cwd
+	}
+	if runAs != nil {
+		env = mergeEnv(env, userEnv(runAs))
+	}
+	proc := exec.Command(spec.interpreter, append([]string{scriptPath}, spec.args...)...)
+	proc.Dir = cwd
+	proc.Env = mergeEnv(env, opts.Env)
+	if cred != nil {
+		proc.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+	result := runProcess(ctx, proc, c.newOutputStream(cmd))
+	if result.Started() && saveSession {
+		if err := session.update(dir.statePath()); err != nil && c.Debug {
+			log.Printf("can't update exec session %s: %v\n", cmd.Session, err)
+		}
+	}
+	return result
+}
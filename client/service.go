@@ -0,0 +1,220 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var unitProperties = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState",
+	"MainPID", "ActiveEnterTimestampMonotonic",
+}
+
+// syslog priority of the informational messages
+const journalInfoPriority = 6
+
+// runTool runs the system tool with the extra environment and returns its
+// stdout, the error contains the tool stderr.
+func runTool(ctx context.Context, env []string, tool string, args ...string) ([]byte, error) {
+	proc := exec.CommandContext(ctx, tool, args...)
+	proc.Env = append(append(os.Environ(), env...), "LC_ALL=C")
+	var stdout, stderr bytes.Buffer
+	proc.Stdout, proc.Stderr = &stdout, &stderr
+	if err := proc.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", tool, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", tool, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// runSystemd runs the systemd tool without the pager and colors.
+func runSystemd(ctx context.Context, tool string, args ...string) ([]byte, error) {
+	return runTool(ctx, []string{"SYSTEMD_PAGER=", "SYSTEMD_COLORS=0"}, tool, args...)
+}
+
+func serviceUnitNames(ctx context.Context) ([]string, error) {
+	out, err := runSystemd(ctx, "systemctl", "list-units", "--type=service", "--all", "--plain", "--no-legend", "--no-pager")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// the not found units are marked with the bullet
+		fields := strings.Fields(strings.TrimLeft(line, "● "))
+		if len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names, nil
+}
+
+func unitsStatus(ctx context.Context, names []string) ([]core.Unit, error) {
+	if len(names) == 0 {
+		return []core.Unit{}, nil
+	}
+	args := []string{"show", "--no-pager", "-p", strings.Join(unitProperties, ","), "--"}
+	out, err := runSystemd(ctx, "systemctl", append(args, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+	units := make([]core.Unit, 0, len(names))
+	// the properties of the units are separated by empty lines
+	for _, block := range strings.Split(string(out), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		unit := core.Unit{}
+		for _, line := range strings.Split(block, "\n") {
+			eq := strings.IndexByte(line, '=')
+			if eq < 0 {
+				continue
+			}
+			value := line[eq+1:]
+			switch line[:eq] {
+			case "Id":
+				unit.Name = value
+			case "Description":
+				unit.Description = value
+			case "LoadState":
+				unit.LoadState = value
+			case "ActiveState":
+				unit.ActiveState = value
+			case "SubState":
+				unit.SubState = value
+			case "UnitFileState":
+				unit.UnitFileState = value
+			case "MainPID":
+				unit.MainPID, _ = strconv.Atoi(value)
+			case "ActiveEnterTimestampMonotonic":
+				if usec, _ := strconv.ParseInt(value, 10, 64); usec > 0 {
+					unit.ActiveSince = boot.Add(time.Duration(usec) * time.Microsecond)
+				}
+			}
+		}
+		units = append(units, unit)
+	}
+	return units, nil
+}
+
+// journalEntry is the journalctl JSON record, the message is an array of
+// bytes if it's not a valid UTF-8 string.
+type journalEntry struct {
+	RealtimeTimestamp string          `json:"__REALTIME_TIMESTAMP"`
+	Unit              string          `json:"_SYSTEMD_UNIT"`
+	PID               string          `json:"_PID"`
+	Priority          string          `json:"PRIORITY"`
+	Message           json.RawMessage `json:"MESSAGE"`
+}
+
+func (e *journalEntry) message() string {
+	var message string
+	if err := json.Unmarshal(e.Message, &message); err == nil {
+		return message
+	}
+	var data []byte
+	var numbers []int
+	if err := json.Unmarshal(e.Message, &numbers); err == nil {
+		for _, n := range numbers {
+			data = append(data, byte(n))
+		}
+	}
+	return string(data)
+}
+
+func readJournal(ctx context.Context, units []string, lines int) ([]core.JournalEntry, error) {
+	args := []string{"--no-pager", "-o", "json", "-n", strconv.Itoa(lines)}
+	for _, unit := range units {
+		args = append(args, "-u", unit)
+	}
+	out, err := runSystemd(ctx, "journalctl", args...)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]core.JournalEntry, 0, lines)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), core.MaxCatSize)
+	for scanner.Scan() {
+		var raw journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			continue
+		}
+		entry := core.JournalEntry{Unit: raw.Unit, Message: raw.message()}
+		if usec, err := strconv.ParseInt(raw.RealtimeTimestamp, 10, 64); err == nil {
+			entry.Time = time.Unix(0, usec*int64(time.Microsecond))
+		}
+		entry.PID, _ = strconv.Atoi(raw.PID)
+		// the entries without priority are informational
+		entry.Priority = journalInfoPriority
+		if priority, err := strconv.Atoi(raw.Priority); err == nil {
+			entry.Priority = priority
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (c *Client) ServiceCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.ServiceRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return errorResp(err)
+	}
+	for _, unit := range req.Units {
+		if unit == "" || strings.HasPrefix(unit, "-") {
+			return errorResp(fmt.Errorf("incorrect unit name: %q", unit))
+		}
+	}
+	result := &core.ServiceResult{Action: req.Action}
+	var err error
+	switch req.Action {
+	case core.ServiceActionStatus:
+		units := req.Units
+		if len(units) == 0 {
+			if units, err = serviceUnitNames(ctx); err != nil {
+				return errorResp(err)
+			}
+		}
+		if result.Units, err = unitsStatus(ctx, units); err != nil {
+			return errorResp(err)
+		}
+	case core.ServiceActionJournal:
+		if len(req.Units) == 0 {
+			return errorResp(fmt.Errorf("no units given"))
+		}
+		if req.Lines <= 0 {
+			req.Lines = core.DefaultJournalLines
+		}
+		if result.Journal, err = readJournal(ctx, req.Units, req.Lines); err != nil {
+			return errorResp(err)
+		}
+	case core.ServiceActionStart, core.ServiceActionStop, core.ServiceActionRestart,
+		core.ServiceActionEnable, core.ServiceActionDisable:
+		if len(req.Units) == 0 {
+			return errorResp(fmt.Errorf("no units given"))
+		}
+		args := append([]string{req.Action, "--no-pager", "--"}, req.Units...)
+		if _, err := runSystemd(ctx, "systemctl", args...); err != nil {
+			return errorResp(err)
+		}
+		if result.Units, err = unitsStatus(ctx, req.Units); err != nil {
+			return errorResp(err)
+		}
+	default:
+		return errorResp(fmt.Errorf("unknown service action: %s", req.Action))
+	}
+	return jsonResp(result)
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const execSessionTTL = 24 * time.Hour
+
+// execSession is the working directory and the environment kept between
+// exec commands of the same console session.
+type execSession struct {
+	*sync.Mutex
+	cwd      string
+	env      []string
+	lastUsed time.Time
+}
+
+func newExecSession() *execSession {
+	cwd, err := os.UserHomeDir()
+	if err != nil {
+		cwd = "/"
+	}
+	return &execSession{
+		Mutex:    new(sync.Mutex),
+		cwd:      cwd,
+		env:      os.Environ(),
+		lastUsed: time.Now(),
+	}
+}
+
+// execSession returns the session context, commands without a session get
+// a fresh one which isn't saved.
+func (c *Client) execSession(sessionId string) *execSession {
+	if sessionId == "" {
+		return newExecSession()
+	}
+	c.Lock()
+	defer c.Unlock()
+	for id, session := range c.execSessions {
+		if time.Since(session.lastUsed) > execSessionTTL {
+			delete(c.execSessions, id)
+		}
+	}
+	session, ok := c.execSessions[sessionId]
+	if !ok {
+		session = newExecSession()
+		c.execSessions[sessionId] = session
+	}
+	return session
+}
+
+func (s *execSession) snapshot() (cwd string, env []string) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastUsed = time.Now()
+	cwd = s.cwd
+	if info, err := os.Stat(cwd); err != nil || !info.IsDir() {
+		cwd = "/"
+	}
+	return cwd, append([]string(nil), s.env...)
+}
+
+// update applies the state file written by the script exit trap: the
+// working directory followed by the environment, all NUL separated.
+func (s *execSession) update(statePath string) error {
+	content, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		return err
+	}
+	fields := bytes.Split(bytes.TrimRight(content, "\x00"), []byte{0})
+	if len(fields) == 0 || len(fields[0]) == 0 {
+		return fmt.Errorf("empty session state")
+	}
+
+	env := make([]string, 0, len(fields)-1)
+	for _, field := range fields[1:] {
+		entry := string(field)
+		if isShellInternalVar(entry) {
+			continue
+		}
+		env = append(env, entry)
+	}
+	s.Lock()
+	s.cwd = string(fields[0])
+	s.env = env
+	s.lastUsed = time.Now()
+	s.Unlock()
+	return nil
+}
+
+func isShellInternalVar(entry string) bool {
+	for _, prefix := range []string{"PWD=", "OLDPWD=", "SHLVL=", "_="} {
+		if strings.HasPrefix(entry, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionScript wraps the shell command to save the session state on exit.
+func sessionScript(shellCommand, statePath string) string {
+	saveState := fmt.Sprintf(
+		`__ww_status=$?; { printf '%%s\0' "$PWD"; env -0; } > %s; exit $__ww_status`,
+		shellQuote(statePath),
+	)
+	return "trap " + shellQuote(saveState) + " EXIT\n" + shellCommand + "\n"
+}
+
+// shellQuote quotes the string for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"github.com/xorium/wormwhole/core"
+	"log"
+	"sync"
+)
+
+// outputStream sends command output to the server as soon as it's written.
+type outputStream struct {
+	*sync.Mutex
+	client *Client
+	cmd    *core.Command
+	seq    uint64
+}
+
+func (c *Client) newOutputStream(cmd *core.Command) *outputStream {
+	return &outputStream{
+		Mutex:  new(sync.Mutex),
+		client: c,
+		cmd:    cmd,
+	}
+}
+
+func (s *outputStream) Writer(stream string) *streamWriter {
+	return &streamWriter{output: s, stream: stream}
+}
+
+func (s *outputStream) send(stream string, data []byte) {
+	s.Lock()
+	defer s.Unlock()
+	s.seq++
+	err := s.client.send(core.NewChunkMessage(s.cmd.ID, stream, s.seq, data))
+	if err != nil && s.client.Debug {
+		log.Printf("can't send command %s output chunk: %v\n", s.cmd.ID, err)
+	}
+}
+
+type streamWriter struct {
+	output *outputStream
+	stream string
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	w.output.send(w.stream, data)
+	return len(p), nil
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"io"
+	"os"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+const (
+	tailPollInterval = 500 * time.Millisecond
+	tailReadSize     = 32 * 1024
+	// the longer line is sent without waiting for its end
+	tailMaxLineSize = 64 * 1024
+)
+
+// fileTail follows the file by its path, the file is reopened after
+// rotation and reread after truncation.
+type fileTail struct {
+	path   string
+	file   *os.File
+	inode  uint64
+	offset int64
+	filter *regexp.Regexp
+	// incomplete last line
+	pending []byte
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
+
+func (t *fileTail) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+	t.file, t.inode, t.offset = f, fileInode(info), 0
+	return nil
+}
+
+// seekLastLines moves the offset to the start of the last lines.
+func (t *fileTail) seekLastLines(lines int) error {
+	info, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+	t.offset = end
+	if lines <= 0 {
+		return nil
+	}
+	buf := make([]byte, tailReadSize)
+	newlines := 0
+	for t.offset > 0 {
+		size := int64(len(buf))
+		if t.offset < size {
+			size = t.offset
+		}
+		chunk := buf[:size]
+		if _, err := t.file.ReadAt(chunk, t.offset-size); err != nil {
+			return err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			// the newline ending the file doesn't start a line
+			if chunk[i] != '\n' || t.offset-size+int64(i) == end-1 {
+				continue
+			}
+			if newlines++; newlines == lines {
+				t.offset = t.offset - size + int64(i) + 1
+				return nil
+			}
+		}
+		t.offset -= size
+	}
+	return nil
+}
+
+// read sends the data appended to the file since the last read.
+func (t *fileTail) read() error {
+	buf := make([]byte, tailReadSize)
+	for {
+		n, err := t.file.ReadAt(buf, t.offset)
+		if n > 0 {
+			t.offset += int64(n)
+			t.write(buf[:n])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *fileTail) write(data []byte) {
+	data = append(t.pending, data...)
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end == 0 && len(data) >= tailMaxLineSize {
+		end = len(data)
+	}
+	t.pending = append([]byte(nil), data[end:]...)
+	if end == 0 {
+		return
+	}
+	if t.filter == nil {
+		_, _ = t.stdout.Write(data[:end])
+		return
+	}
+	var matched []byte
+	for _, line := range bytes.SplitAfter(data[:end], []byte("\n")) {
+		// anchored filters match the line without its end
+		if len(line) > 0 && t.filter.Match(bytes.TrimRight(line, "\r\n")) {
+			matched = append(matched, line...)
+		}
+	}
+	if len(matched) > 0 {
+		_, _ = t.stdout.Write(matched)
+	}
+}
+
+func (t *fileTail) notify(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(t.stderr, "tail: "+format+"\n", args...)
+}
+
+// check reopens the rotated file and rewinds the truncated one.
+func (t *fileTail) check() error {
+	info, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		// wait for the new file after rotation
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if inode := fileInode(info); inode != t.inode {
+		// the rest of the rotated file
+		if err := t.read(); err != nil {
+			return err
+		}
+		if err := t.open(); err != nil {
+			return err
+		}
+		t.notify("%s has been rotated", t.path)
+		return nil
+	}
+	if info.Size() < t.offset {
+		t.offset = 0
+		t.pending = nil
+		t.notify("%s has been truncated", t.path)
+	}
+	return nil
+}
+
+func (t *fileTail) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+}
+
+func (c *Client) TailCmd(ctx context.Context, cmd *core.Command) (code string, resp []byte) {
+	var req core.TailRequest
+	if err := cmd.DecodeArg(0, &req); err != nil {
+		return errorResp(err)
+	}
+	output := c.newOutputStream(cmd)
+	t := &fileTail{
+		path:   c.resolvePath(cmd, req.Path),
+		stdout: output.Writer(core.StreamStdout),
+		stderr: output.Writer(core.StreamStderr),
+	}
+	if req.Filter != "" {
+		filter, err := regexp.Compile(req.Filter)
+		if err != nil {
+			return errorResp(fmt.Errorf("incorrect filter: %v", err))
+		}
+		t.filter = filter
+	}
+	if err := t.open(); err != nil {
+		return errorResp(err)
+	}
+	defer t.close()
+	if err := t.seekLastLines(req.Lines); err != nil {
+		return errorResp(err)
+	}
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := t.read(); err != nil {
+			return errorResp(err)
+		}
+		select {
+		case <-ctx.Done():
+			return core.CommandResultCodeSuccess, nil
+		case <-ticker.C:
+		}
+		if err := t.check(); err != nil {
+			return errorResp(err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/xorium/wormwhole/core"
+	"net/http"
+	"time"
+)
+
+func (c *Client) SetTLS(certFile, keyFile, caFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("can't load client certificate: %v", err)
+	}
+	rootCAs, err := core.LoadCertPool(caFile)
+	if err != nil {
+		return fmt.Errorf("can't load server CA: %v", err)
+	}
+
+	c.Lock()
+	c.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	c.httpClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: c.tlsConfig},
+	}
+	c.Unlock()
+	return nil
+}
+
+func (c *Client) dialer() *websocket.Dialer {
+	c.RLock()
+	defer c.RUnlock()
+	return &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  c.tlsConfig,
+	}
+}
+
+// httpScheme returns the scheme of plain HTTP endpoints matching the
+// websocket protocol.
+func (c *Client) httpScheme() string {
+	if c.proto == "wss" {
+		return "https"
+	}
+	return "http"
+}
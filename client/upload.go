@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// time to wait for the upload data before giving up, the partial file
+	// is kept to resume the upload later
+	transferIdleTimeout = 2 * time.Minute
+	defaultUploadMode   = 0644
+)
+
+var sha256Pattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// fileUpload receives the uploaded file into the partial file, which is
+// renamed to the target path once the checksum is verified.
+type fileUpload struct {
+	*sync.Mutex
+	req         *core.UploadRequest
+	owner       *syscall.Credential
+	partialPath string
+	file        *os.File
+	offset      int64
+	resumedFrom int64
+	err         error
+	done        chan struct{}
+	received    chan struct{}
+}
+
+func openUpload(req *core.UploadRequest) (*fileUpload, error) {
+	if !sha256Pattern.MatchString(req.SHA256) {
+		return nil, fmt.Errorf("incorrect checksum: %q", req.SHA256)
+	}
+	if req.Size < 0 {
+		return nil, fmt.Errorf("incorrect size: %d", req.Size)
+	}
+	// the owner is checked before the data is sent
+	owner, _, err := lookupCredential(req.Owner, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	// the partial file name depends on the content to resume the same
+	// file only
+	partialPath := filepath.Join(
+		filepath.Dir(req.Path), fmt.Sprintf(".%s.%s.part", filepath.Base(req.Path), req.SHA256[:12]),
+	)
+	f, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	offset := info.Size()
+	if offset > req.Size {
+		offset = 0
+	}
+	if err := f.Truncate(offset); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, 0); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	u := &fileUpload{
+		Mutex:       new(sync.Mutex),
+		req:         req,
+		owner:       owner,
+		partialPath: partialPath,
+		file:        f,
+		offset:      offset,
+		resumedFrom: offset,
+		done:        make(chan struct{}),
+		received:    make(chan struct{}, 1),
+	}
+	if offset == req.Size {
+		close(u.done)
+	}
+	return u, nil
+}
+
+func (u *fileUpload) currentOffset() int64 {
+	u.Lock()
+	defer u.Unlock()
+	return u.offset
+}
+
+// write appends the chunk if it continues the received data, chunks
+// resent after reconnect are skipped.
+func (u *fileUpload) write(chunk *core.TransferChunk) {
+	u.Lock()
+	defer u.Unlock()
+	if u.offset == u.req.Size || u.err != nil || chunk.Offset != u.offset {
+		return
+	}
+	select {
+	case u.received <- struct{}{}:
+	default:
+	}
+	if u.offset+int64(len(chunk.Data)) > u.req.Size {
+		u.err = fmt.Errorf("received more data than %d bytes", u.req.Size)
+		close(u.done)
+		return
+	}
+	n, err := u.file.Write(chunk.Data)
+	u.offset += int64(n)
+	if err != nil {
+		u.err = err
+		close(u.done)
+		return
+	}
+	if u.offset == u.req.Size {
+		close(u.done)
+	}
+}
+
+func (u *fileUpload) wait(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-u.done:
+			u.Lock()
+			defer u.Unlock()
+			return u.err
+		case <-u.received:
+		case <-time.After(transferIdleTimeout):
+			return fmt.Errorf("upload stalled at offset %d", u.currentOffset())
+		}
+	}
+}
+
+// commit verifies the received file and moves it to the target path.
+func (u *fileUpload) commit() (*core.TransferResult, error) {
+	if err := u.file.Sync(); err != nil {
+		return nil, err
+	}
+	if err := u.file.Close(); err != nil {
+		return nil, err
+	}
+	checksum, err := core.FileSHA256(u.partialPath)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != u.req.SHA256 {
+		u.remove()
+		return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", u.req.SHA256, checksum)
+	}
+
+	mode := os.FileMode(defaultUploadMode)
+	if u.req.Mode != nil {
+		mode = os.FileMode(*u.req.Mode)
+	}
+	if err := os.Chmod(u.partialPath, mode); err != nil {
+		return nil, err
+	}
+	if u.owner != nil {
+		if err := os.Chown(u.partialPath, int(u.owner.Uid), int(u.owner.Gid)); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Rename(u.partialPath, u.req.Path); err != nil {
+		return nil, err
+	}
+	return &core.TransferResult{
+		Path:        u.req.Path,
+		Size:        u.req.Size,
+		SHA256:      checksum,
+		ResumedFrom: u.resumedFrom,
+	}, nil
+}
+
+func (u *fileUpload) close() {
+	_ = u.file.Close()
+}
+
+func (u *fileUpload) remove() {
+	if err := os.Remove(u.partialPath); err != nil && !os.IsNotExist(err) {
+		log.Println("error while removing partial upload: ", err)
+	}
+}
+
+func (c *Client) ackUpload(commandId string, u *fileUpload) {
+	if err := c.send(core.NewUploadAckMessage(commandId, u.currentOffset())); err != nil {
+		log.Printf("can't acknowledge upload %s: %v\n", commandId, err)
+	}
+}
+
+func (c *Client) handleUploadData(chunk *core.TransferChunk) {
+	c.RLock()
+	u, ok := c.uploads[chunk.CommandID]
+	c.RUnlock()
+	if ok {
+		u.write(chunk)
+	}
+}
+
+// resumeUpload acknowledges the current offset of the running upload
+// command delivered again after reconnect.
+func (c *Client) resumeUpload(commandId string) {
+	c.RLock()
+	u, ok := c.uploads[commandId]
+	c.RUnlock()
+	if ok {
+		c.ackUpload(commandId, u)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -49,9 +50,11 @@ func (c *Client) saveSettings() {
 
 func (c *Client) loadSettings() {
 	c.goToBinaryDir()
-	f, err := os.Create(settingsFile)
+	f, err := os.Open(settingsFile)
 	if err != nil {
-		log.Println(err)
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
 		return
 	}
 	defer func() { _ = f.Close() }()
@@ -73,6 +76,31 @@ func (c *Client) loadSettings() {
 	}
 }
 
+func (c *Client) loadCredential() string {
+	c.goToBinaryDir()
+	content, err := ioutil.ReadFile(credentialFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func (c *Client) saveCredential(credential string) error {
+	c.goToBinaryDir()
+	return ioutil.WriteFile(credentialFile, []byte(credential), 0600)
+}
+
+func (c *Client) removeCredential() error {
+	c.goToBinaryDir()
+	if err := os.Remove(credentialFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (c *Client) getSettingString(key string) string {
 	c.RLock()
 	value, ok := c.settings[key]
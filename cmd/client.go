@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"github.com/xorium/wormwhole/client"
+	"log"
+	"time"
 )
 
 func main() {
@@ -10,14 +12,36 @@ func main() {
 		inProto    = "ws"
 		serverAddr = "127.0.0.1:39746"
 		debug      = false
+		certFile   = ""
+		keyFile    = ""
+		caFile     = ""
+		joinToken  = ""
+		shell      = "bash"
+		metrics    = 10 * time.Second
 	)
 
 	flag.StringVar(&serverAddr, "addr", "ws://127.0.0.1:39746", "server address")
 	flag.StringVar(&inProto, "proto", "ws", "connection protocol")
 	flag.BoolVar(&debug, "debug", false, "debug mode")
+	flag.StringVar(&certFile, "cert", "", "bot TLS certificate file")
+	flag.StringVar(&keyFile, "key", "", "bot TLS private key file")
+	flag.StringVar(&caFile, "ca", "", "CA file to verify the server certificate")
+	flag.StringVar(&joinToken, "token", "", "one-time join token to enroll the bot")
+	flag.StringVar(&shell, "interpreter", "bash", "interpreter of exec commands")
+	flag.DurationVar(&metrics, "metrics-interval", 10*time.Second, "interval of pushing metrics, 0 disables them")
 	flag.Parse()
 
 	cli := client.NewClient(serverAddr, inProto)
 	cli.Debug = debug
-	cli.Run()
+	cli.JoinToken = joinToken
+	cli.Interpreter = shell
+	cli.MetricsInterval = metrics
+	if certFile != "" {
+		if err := cli.SetTLS(certFile, keyFile, caFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := cli.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
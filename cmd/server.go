@@ -4,20 +4,53 @@ import (
 	"flag"
 	"github.com/xorium/wormwhole/console"
 	"github.com/xorium/wormwhole/server"
+	"log"
 )
 
 func main() {
 	var (
-		listenAddr string
-		debug      bool
+		listenAddr   string
+		debug        bool
+		certFile     string
+		keyFile      string
+		clientCAFile string
+		dbPath       string
+		downloadDir  string
+		maxDownload  int64
+		artifactDir  string
+		quota        int64
 	)
 
 	flag.StringVar(&listenAddr, "addr", ":39746", "addr to listen")
 	flag.BoolVar(&debug, "debug", false, "debug mode")
+	flag.StringVar(&certFile, "cert", "", "server TLS certificate file")
+	flag.StringVar(&keyFile, "key", "", "server TLS private key file")
+	flag.StringVar(&clientCAFile, "client-ca", "", "CA file to verify bots certificates")
+	flag.StringVar(&dbPath, "db", "wormwhole.db", "path to the server database")
+	flag.StringVar(&downloadDir, "download-dir", "downloads", "directory to store downloaded files in")
+	flag.Int64Var(&maxDownload, "max-download", 1<<30, "max size of downloaded file in bytes")
+	flag.StringVar(&artifactDir, "artifact-dir", "artifacts", "directory to store artifacts posted by bots in")
+	flag.Int64Var(&quota, "artifact-quota", 1<<30, "max total size of artifacts of one bot in bytes")
 	flag.Parse()
 
-	srv := server.NewCommandServer(listenAddr)
+	store, err := server.OpenStore(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := server.NewCommandServer(listenAddr, store)
 	srv.Debug = debug
+	srv.MaxDownloadSize = maxDownload
+	if err := srv.SetDownloadDir(downloadDir); err != nil {
+		log.Fatal(err)
+	}
+	if err := srv.SetArtifactStore(artifactDir, quota); err != nil {
+		log.Fatal(err)
+	}
+	if certFile != "" {
+		if err := srv.SetTLS(certFile, keyFile, clientCAFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 	go srv.Run()
 
 	c := console.NewConsole(srv)
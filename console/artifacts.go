@@ -0,0 +1,87 @@
+package console
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/fatih/color"
+	"io"
+	"os"
+	"strings"
+)
+
+func (c *Console) ArtifactsCmdHandler(_ []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	artifacts, err := c.srv.Artifacts().List(currBot.ID)
+	if err != nil {
+		return fmt.Errorf("can't list artifacts: %v", err)
+	}
+	if len(artifacts) == 0 {
+		color.HiYellow("there are no artifacts of the bot")
+		return nil
+	}
+	listRes := ""
+	var usage int64
+	for _, artifact := range artifacts {
+		listRes += fmt.Sprintf(
+			"%s  %10d  %s  %s\n",
+			artifact.SHA256[:12], artifact.Size, artifact.CreatedAt.Format("2006-01-02 15:04:05"), artifact.Name,
+		)
+		usage += artifact.Size
+	}
+	listRes += fmt.Sprintf("total: %d bytes", usage)
+	color.HiBlue(listRes)
+	return nil
+}
+
+// FetchArtifactCmdHandler copies the artifact of the current bot to the
+// local file verifying its checksum.
+func (c *Console) FetchArtifactCmdHandler(matches []string) error {
+	if len(matches) < 2 {
+		return fmt.Errorf("incorrect command format")
+	}
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	args := strings.Fields(matches[1])
+	if len(args) != 2 {
+		return fmt.Errorf("artifact checksum prefix and local path are required")
+	}
+
+	store := c.srv.Artifacts()
+	artifact, err := store.Find(currBot.ID, args[0])
+	if err != nil {
+		return err
+	}
+	src, err := store.Open(artifact)
+	if err != nil {
+		return fmt.Errorf("can't open artifact: %v", err)
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("can't create local file: %v", err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, hash), src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != artifact.SHA256 {
+		err = fmt.Errorf("stored artifact is corrupted")
+	}
+	if err != nil {
+		_ = os.Remove(args[1])
+		return fmt.Errorf("can't fetch artifact: %v", err)
+	}
+	color.White("%s: %d bytes saved to %s", artifact.Name, artifact.Size, args[1])
+	return nil
+}
@@ -3,22 +3,54 @@ package console
 import (
 	"fmt"
 	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
 	"github.com/xorium/wormwhole/server"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func (c *Console) initCommands() {
 	c.commandsHandlers = map[*regexp.Regexp]func([]string) error{
-		regexp.MustCompile("help *"):       c.HelpCmdHandler,
-		regexp.MustCompile("exit *"):       c.ExitCmdHandler,
-		regexp.MustCompile("exec +(.+)"):   c.ExecCmdHandler,
-		regexp.MustCompile("ping *"):       c.PingCmdHandler,
-		regexp.MustCompile("list *"):       c.ListCmdHandler,
-		regexp.MustCompile("cmd_states *"): c.ListCommandsStatesCmdHandler,
-		regexp.MustCompile("use (\\d+)"):   c.UseCmdHandler,
-		regexp.MustCompile("alias +(.+)"):  c.AliasCmdHandler,
+		commandPattern("help *"):                      c.HelpCmdHandler,
+		commandPattern("exit *"):                      c.ExitCmdHandler,
+		commandPattern("exec +(.+)"):                  c.ExecCmdHandler,
+		commandPattern("ping *"):                      c.PingCmdHandler,
+		commandPattern("list *"):                      c.ListCmdHandler,
+		commandPattern("cmd_states *"):                c.ListCommandsStatesCmdHandler,
+		commandPattern("use (\\d+)"):                  c.UseCmdHandler,
+		commandPattern("alias +(.+)"):                 c.AliasCmdHandler,
+		commandPattern("label((?: +\\S+)*) *"):        c.LabelCmdHandler,
+		commandPattern("token *"):                     c.TokenCmdHandler,
+		commandPattern("revoke *"):                    c.RevokeCmdHandler,
+		commandPattern("counters *"):                  c.CountersCmdHandler,
+		commandPattern("shell *"):                     c.ShellCmdHandler,
+		commandPattern("script +(.+)"):                c.ScriptCmdHandler,
+		commandPattern("interpreters *"):              c.InterpretersCmdHandler,
+		commandPattern("upload +(.+)"):                c.UploadCmdHandler,
+		commandPattern("download +(.+)"):              c.DownloadCmdHandler,
+		commandPattern("artifacts *"):                 c.ArtifactsCmdHandler,
+		commandPattern("artifact +(.+)"):              c.FetchArtifactCmdHandler,
+		commandPattern("ls(?: +" + fileArgs + ")? *"): c.LsCmdHandler,
+		commandPattern("stat +" + fileArgs + " *"):    c.StatCmdHandler,
+		commandPattern("cat +" + fileArgs + " *"):     c.CatCmdHandler,
+		commandPattern("find +" + fileArgs + " *"):    c.FindCmdHandler,
+		commandPattern("sha256 +" + fileArgs + " *"):  c.Sha256CmdHandler,
+		commandPattern("tail +" + fileArgs + " *"):    c.TailCmdHandler,
+		commandPattern("complete +(\\S+)"):            c.CompleteCmdHandler,
+		commandPattern("facts *"):                     c.FactsCmdHandler,
+		commandPattern("stats *"):                     c.StatsCmdHandler,
+		commandPattern("ps((?: +--.*)?) *"):           c.PsCmdHandler,
+		commandPattern("kill +" + killArgs + " *"):    c.KillCmdHandler,
+		commandPattern("service +" + serviceArgs):     c.ServiceCmdHandler,
+		commandPattern("packages((?: +--.*)?) *"):     c.PackagesCmdHandler,
+		commandPattern("whohas +(.+)"):                c.WhohasCmdHandler,
+		commandPattern("queue *"):                     c.QueueCmdHandler,
+		commandPattern("unqueue +(\\d+) *"):           c.UnqueueCmdHandler,
 	}
 }
 
@@ -26,15 +58,70 @@ func (c *Console) HelpCmdHandler(_ []string) error {
 	color.Cyan(`help				print help for commands
 exit				shutdown the server
 ping				check if bot is alive
-list				list connected bots
+list				list known bots, offline ones as well
 cmd_states			list commands states
-exec [command]			execute shell command
+exec [options] [--] [command]	execute shell command, options:
+				--timeout 30s, --deadline 23:30 or RFC 3339 time,
+				--user name, --group name, --cwd dir,
+				--env KEY=value, --umask 022,
+				--ttl 24h to queue it while bot is offline
 use [bot number]		use bot to interact with
 alias [bot name]		set alias to bot
+label [key=value]		set bot labels, key= removes the label
+token				create one-time bot join token
+revoke				revoke current bot credential
+counters			print server counters
+shell				open interactive shell, Ctrl-] closes it
+script [options] [file] [args]	run local script file on bot, options are
+				the exec ones and --interpreter name
+				(sh, bash, python3, perl or shebang)
+interpreters			list script interpreters available on bot
+upload [options] [src] [dst]	upload file to bot, options:
+				--mode 0644, --owner name, --group name
+download [src] [dst]		download file from bot into the bot directory
+				of the server downloads
+artifacts			list artifacts posted by bot to /rec
+artifact [sha256] [dst]		save artifact by checksum prefix to local file
+ls [path]			list bot directory
+stat [path]			print bot file info
+cat [options] [path]		print bot file, options: --offset 1k, --length 4k
+find [options] [path]		find bot files, options: --name *.log,
+				--type f|d|l, --min-size 1m, --max-size 1g,
+				--max-depth 2, --limit 100
+sha256 [path]			print sha256 of bot file
+tail [options] [path]		follow bot file until Ctrl-C, options:
+				--lines 10, --grep regexp
+complete [path]			list bot files starting with path
+facts				collect and print bot host facts
+stats				show bot metrics until a key is pressed
+ps [options]			list bot processes, options: --sort pid|cpu|rss|start,
+				--user name, --grep regexp, --limit 20
+kill [options] [pid]		signal bot process after confirmation, options:
+				--signal TERM, --tree to signal its descendants too
+service [options] [action] [units]
+				manage systemd units, actions: status, start, stop,
+				restart, enable, disable, journal, options:
+				--bots all|0,2 to run on bots of the list at once,
+				--lines 20 of the journal
+packages [options]		collect bot packages and updates, options:
+				--bots all|0,2, --grep regexp, --updates to list
+				the updates only
+whohas [name] [op version]	search collected packages of all bots, op is
+				one of <, <=, =, !=, >=, >
+queue				list commands queued for offline bots
+unqueue [command id]		remove command from the queue
 	`)
 	return nil
 }
 
+// commandPattern compiles the pattern matching the whole command input
+// with the surrounding spaces. The shell input only containing a command
+// name, like "cat /var/log/ps" or "download /etc/token", isn't taken for
+// that command and runs on the bot as exec does.
+func commandPattern(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^ *" + pattern + " *$")
+}
+
 func (c *Console) handleCommandInput(text string) error {
 	if c.currentState == stateExecutingCommand {
 		return nil
@@ -75,6 +162,34 @@ func (c *Console) ListCommandsStatesCmdHandler(_ []string) error {
 	return nil
 }
 
+// executeCommand sends the command and waits for its result before
+// accepting the next input, unless the command is queued for the offline
+// bot.
+func (c *Console) executeCommand(cmd *core.Command, bot *server.Bot) error {
+	cmd.Session = c.sessionId
+	c.Lock()
+	c.currentState = stateExecutingCommand
+	c.foregroundCmd = cmd.ID
+	c.Unlock()
+	err := c.srv.SendCommand(cmd, bot)
+	if err != nil || cmd.State() == core.CommandStateQueued {
+		c.Lock()
+		c.currentState = stateReady
+		c.foregroundCmd = ""
+		c.Unlock()
+	}
+	if err != nil {
+		if cmd.TTL == 0 && c.srv.Bot(bot.ID) == nil {
+			return fmt.Errorf("bot is offline, exec and script commands can be queued with --ttl")
+		}
+		return err
+	}
+	if cmd.State() == core.CommandStateQueued {
+		color.HiYellow("bot is offline, command %s has been queued for %s", cmd.ID, cmd.TTL)
+	}
+	return nil
+}
+
 func (c *Console) ExecCmdHandler(matches []string) error {
 	if len(matches) < 2 {
 		return fmt.Errorf("incorrect command format")
@@ -86,13 +201,156 @@ func (c *Console) ExecCmdHandler(matches []string) error {
 		return fmt.Errorf("bot is unselected")
 	}
 
-	c.Lock()
-	c.currentState = stateExecutingCommand
-	c.Unlock()
-	return c.srv.SendCommand(
-		server.ExecCommand(matches[1]),
-		c.currentBot,
-	)
+	opts, shellCommand, err := splitOptions(matches[1])
+	if err != nil {
+		return err
+	}
+	if shellCommand == "" {
+		return fmt.Errorf("empty shell command")
+	}
+	cmd := server.ExecCommand(shellCommand)
+	if err := applyExecOptions(cmd, opts); err != nil {
+		return err
+	}
+	return c.executeCommand(cmd, currBot)
+}
+
+func (c *Console) ScriptCmdHandler(matches []string) error {
+	if len(matches) < 2 {
+		return fmt.Errorf("incorrect command format")
+	}
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+
+	opts, rest, err := splitOptions(matches[1])
+	if err != nil {
+		return err
+	}
+	args := strings.Fields(rest)
+	if len(args) == 0 {
+		return fmt.Errorf("script file is required")
+	}
+	body, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("can't read script: %v", err)
+	}
+	interpreter := opts.Get("interpreter")
+	if interpreter == "" {
+		interpreter = core.InterpreterShebang
+	}
+	if !isScriptInterpreter(interpreter) {
+		return fmt.Errorf(
+			"unknown interpreter %s, expected one of: %s, %s",
+			interpreter, strings.Join(core.ScriptInterpreters, ", "), core.InterpreterShebang,
+		)
+	}
+	cmd := server.ScriptCommand(interpreter, string(body), args[1:])
+	if err := applyExecOptions(cmd, opts); err != nil {
+		return err
+	}
+	return c.executeCommand(cmd, currBot)
+}
+
+func isScriptInterpreter(name string) bool {
+	if name == core.InterpreterShebang {
+		return true
+	}
+	for _, interpreter := range core.ScriptInterpreters {
+		if interpreter == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Console) InterpretersCmdHandler(_ []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	return c.executeCommand(server.InterpretersCommand(), currBot)
+}
+
+// applyExecOptions sets the timeout and process options of the command.
+func applyExecOptions(cmd *core.Command, opts commandOptions) error {
+	if opts.Has("timeout") {
+		timeout, err := time.ParseDuration(opts.Get("timeout"))
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("incorrect timeout: %s", opts.Get("timeout"))
+		}
+		cmd.SetTimeout(timeout)
+	}
+	if opts.Has("deadline") {
+		deadline, err := parseDeadline(opts.Get("deadline"), time.Now())
+		if err != nil {
+			return err
+		}
+		cmd.SetDeadline(deadline)
+	}
+	if opts.Has("ttl") {
+		ttl, err := time.ParseDuration(opts.Get("ttl"))
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("incorrect ttl: %s", opts.Get("ttl"))
+		}
+		cmd.SetTTL(ttl)
+	}
+	var err error
+	cmd.Exec, err = parseExecOptions(opts)
+	return err
+}
+
+// parseDeadline parses the RFC 3339 time or the local HH:MM time, which is
+// the next occurrence of it.
+func parseDeadline(value string, now time.Time) (time.Time, error) {
+	if deadline, err := time.Parse(time.RFC3339, value); err == nil {
+		if !deadline.After(now) {
+			return time.Time{}, fmt.Errorf("deadline %s has passed", value)
+		}
+		return deadline, nil
+	}
+	clock, err := time.ParseInLocation("15:04", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("incorrect deadline: %s", value)
+	}
+	deadline := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	if !deadline.After(now) {
+		deadline = deadline.AddDate(0, 0, 1)
+	}
+	return deadline, nil
+}
+
+// parseExecOptions returns nil if no process options are given.
+func parseExecOptions(opts commandOptions) (*core.ExecOptions, error) {
+	execOpts := &core.ExecOptions{
+		User:  opts.Get("user"),
+		Group: opts.Get("group"),
+		Cwd:   opts.Get("cwd"),
+		Env:   opts["env"],
+	}
+	for _, entry := range execOpts.Env {
+		if !strings.Contains(entry, "=") {
+			return nil, fmt.Errorf("incorrect env entry %q, KEY=value expected", entry)
+		}
+	}
+	if opts.Has("umask") {
+		umask, err := strconv.ParseUint(opts.Get("umask"), 8, 32)
+		if err != nil || umask > 0777 {
+			return nil, fmt.Errorf("incorrect umask: %s", opts.Get("umask"))
+		}
+		value := uint32(umask)
+		execOpts.Umask = &value
+	}
+	if execOpts.User == "" && execOpts.Group == "" && execOpts.Cwd == "" &&
+		len(execOpts.Env) == 0 && execOpts.Umask == nil {
+		return nil, nil
+	}
+	return execOpts, nil
 }
 
 func (c *Console) PingCmdHandler(_ []string) error {
@@ -103,28 +361,26 @@ func (c *Console) PingCmdHandler(_ []string) error {
 		return fmt.Errorf("bot is unselected")
 	}
 
-	c.Lock()
-	c.currentState = stateExecutingCommand
-	c.Unlock()
-	return c.srv.SendCommand(
-		server.PingCommand(),
-		currBot,
-	)
+	return c.executeCommand(server.PingCommand(), currBot)
 }
 
 func (c *Console) ListCmdHandler(_ []string) error {
-	bots := c.srv.ListBots()
-	if len(bots) == 0 {
-		color.HiYellow("there are no connected bots")
+	records := c.refreshBotsList()
+	if len(records) == 0 {
+		color.HiYellow("there are no known bots")
 		return nil
 	}
-	c.Lock()
-	c.currentBotsList = bots
-	c.Unlock()
 	listRes := ""
-	for i, bot := range bots {
-		botStr := c.getBotString(bot)
-		listRes += fmt.Sprintf("[%d] %s\n", i, botStr)
+	for i, record := range records {
+		botStr := c.getAlias(record.ID)
+		if botStr == "" {
+			botStr = record.String()
+		}
+		status := "online"
+		if !record.Online {
+			status = "offline since " + record.LastSeen.Local().Format("2006-01-02 15:04")
+		}
+		listRes += fmt.Sprintf("[%d] %s  %s  %s%s\n", i, botStr, status, factsSummary(record.Facts), formatLabels(record.Labels))
 	}
 	color.HiBlue(listRes)
 	return nil
@@ -138,12 +394,16 @@ func (c *Console) UseCmdHandler(matches []string) error {
 	if err != nil {
 		return fmt.Errorf("incorrect index: %s", matches[1])
 	}
-	if index >= len(c.currentBotsList) {
-		return fmt.Errorf("index %d is out of range of state list", index)
+	bot, err := c.listedBot(index, true)
+	if err != nil {
+		return err
 	}
 	c.Lock()
-	c.currentBot = c.currentBotsList[index]
+	c.currentBot = bot
 	c.Unlock()
+	if c.srv.Bot(bot.ID) == nil {
+		color.HiYellow("bot is offline, exec and script commands with --ttl are queued")
+	}
 	return nil
 }
 
@@ -161,3 +421,102 @@ func (c *Console) AliasCmdHandler(matches []string) error {
 	c.saveAlias(currBot.ID, matches[1])
 	return nil
 }
+
+func (c *Console) TokenCmdHandler(_ []string) error {
+	token, err := c.srv.CreateJoinToken()
+	if err != nil {
+		return fmt.Errorf("can't create join token: %v", err)
+	}
+	color.HiYellow("join token (valid for one enrollment): %s", token)
+	return nil
+}
+
+func (c *Console) RevokeCmdHandler(_ []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+
+	if err := c.srv.RevokeBot(currBot.ID); err != nil {
+		return fmt.Errorf("can't revoke bot %s: %v", currBot.ID, err)
+	}
+	color.HiYellow("bot %s has been revoked", c.getBotString(currBot))
+	return nil
+}
+
+func (c *Console) CountersCmdHandler(_ []string) error {
+	counters := c.srv.Counters()
+	color.HiBlue("rejected results: %d", counters.RejectedResults)
+	return nil
+}
+
+func (c *Console) UploadCmdHandler(matches []string) error {
+	if len(matches) < 2 {
+		return fmt.Errorf("incorrect command format")
+	}
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+
+	opts, rest, err := splitOptions(matches[1])
+	if err != nil {
+		return err
+	}
+	paths := strings.Fields(rest)
+	if len(paths) != 2 {
+		return fmt.Errorf("local and remote paths are required")
+	}
+	localPath, remotePath := paths[0], paths[1]
+	if strings.HasSuffix(remotePath, "/") {
+		remotePath += filepath.Base(localPath)
+	}
+	req := core.UploadRequest{
+		Path:  remotePath,
+		Owner: opts.Get("owner"),
+		Group: opts.Get("group"),
+	}
+	if opts.Has("mode") {
+		mode, err := strconv.ParseUint(opts.Get("mode"), 8, 32)
+		if err != nil || mode > 07777 {
+			return fmt.Errorf("incorrect mode: %s", opts.Get("mode"))
+		}
+		value := uint32(mode)
+		req.Mode = &value
+	}
+	cmd, err := c.srv.NewUpload(localPath, req)
+	if err != nil {
+		return fmt.Errorf("can't upload file: %v", err)
+	}
+	return c.executeCommand(cmd, currBot)
+}
+
+func (c *Console) DownloadCmdHandler(matches []string) error {
+	if len(matches) < 2 {
+		return fmt.Errorf("incorrect command format")
+	}
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+
+	paths := strings.Fields(matches[1])
+	if len(paths) == 0 || len(paths) > 2 {
+		return fmt.Errorf("remote and optional local paths are expected")
+	}
+	remotePath, localName := paths[0], filepath.Base(paths[0])
+	if len(paths) == 2 {
+		localName = paths[1]
+	}
+	cmd, err := c.srv.NewDownload(currBot, remotePath, localName)
+	if err != nil {
+		return fmt.Errorf("can't download file: %v", err)
+	}
+	return c.executeCommand(cmd, currBot)
+}
@@ -0,0 +1,75 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
+	"github.com/xorium/wormwhole/server"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const completionTimeout = 5 * time.Second
+
+// CompleteCmdHandler lists the bot files starting with the path to help
+// typing the paths of the file commands.
+func (c *Console) CompleteCmdHandler(matches []string) error {
+	if len(matches) < 2 {
+		return fmt.Errorf("incorrect command format")
+	}
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+
+	dir, prefix := path.Split(matches[1])
+	names, err := c.remoteFileNames(currBot, dir, prefix)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		color.HiYellow("no files found")
+		return nil
+	}
+	for _, name := range names {
+		color.White("%s%s", dir, name)
+	}
+	return nil
+}
+
+// remoteFileNames returns the sorted names of the bot files in the dir
+// starting with the prefix, directory names end with a slash.
+func (c *Console) remoteFileNames(bot *server.Bot, dir, prefix string) ([]string, error) {
+	cmd := server.LsCommand(dir)
+	cmd.Session = c.sessionId
+	resp, err := c.srv.Call(cmd, bot, completionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var result core.ListResult
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range result.Files {
+		if !strings.HasPrefix(file.Name, prefix) {
+			continue
+		}
+		// hidden files are listed only if asked
+		if strings.HasPrefix(file.Name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		name := file.Name
+		if file.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
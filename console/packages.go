@@ -0,0 +1,151 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
+	"github.com/xorium/wormwhole/server"
+	"os"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const packagesTimeout = 5 * time.Minute
+
+// versionQuery matches "name", "name < 1.2" and the other comparisons.
+var versionQuery = regexp.MustCompile(`^(\S+?) *(?:(<=|>=|!=|<|>|=) *(\S+))? *$`)
+
+var versionOperators = map[string]func(result int) bool{
+	"<":  func(result int) bool { return result < 0 },
+	"<=": func(result int) bool { return result <= 0 },
+	"=":  func(result int) bool { return result == 0 },
+	"!=": func(result int) bool { return result != 0 },
+	">=": func(result int) bool { return result >= 0 },
+	">":  func(result int) bool { return result > 0 },
+}
+
+// PackagesCmdHandler collects the package inventories of the bots, the
+// server keeps the last one of each bot for whohas.
+func (c *Console) PackagesCmdHandler(matches []string) error {
+	opts, rest, err := splitOptions(matches[1], "updates")
+	if err != nil {
+		return err
+	}
+	if rest != "" {
+		return fmt.Errorf("unexpected argument: %s", rest)
+	}
+	filter, err := regexp.Compile(opts.Get("grep"))
+	if err != nil {
+		return fmt.Errorf("incorrect grep regexp: %v", err)
+	}
+	bots, err := c.targetBots(opts.Get("bots"))
+	if err != nil {
+		return err
+	}
+
+	results := c.callBots(bots, server.PackagesCommand, packagesTimeout)
+	for _, result := range results {
+		if len(results) > 1 {
+			color.HiBlue("== %s", c.getBotString(result.bot))
+		}
+		if result.err != nil {
+			color.HiRed("%s", result.err)
+			continue
+		}
+		var inventory core.Inventory
+		if err := json.Unmarshal(result.resp, &inventory); err != nil {
+			color.HiRed("incorrect inventory: %v", err)
+			continue
+		}
+		if len(results) == 1 {
+			printInventory(&inventory, filter, opts.Has("updates"))
+		}
+		color.White("%d %s packages, %d updates", len(inventory.Packages), inventory.Manager, len(inventory.Updates))
+		if inventory.UpdatesError != "" {
+			color.HiYellow("updates are unknown: %s", inventory.UpdatesError)
+		}
+	}
+	return nil
+}
+
+func printInventory(inventory *core.Inventory, filter *regexp.Regexp, updatesOnly bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if updatesOnly {
+		_, _ = fmt.Fprintln(w, "NAME\tINSTALLED\tAVAILABLE")
+		for _, update := range inventory.Updates {
+			if filter.MatchString(update.Name) {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", update.Name, update.Version, update.Available)
+			}
+		}
+	} else {
+		_, _ = fmt.Fprintln(w, "NAME\tVERSION\tARCH")
+		for _, pkg := range inventory.Packages {
+			if filter.MatchString(pkg.Name) {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", pkg.Name, pkg.Version, pkg.Arch)
+			}
+		}
+	}
+	_ = w.Flush()
+}
+
+// WhohasCmdHandler searches the stored inventories of all the bots for
+// the package, optionally comparing its version.
+func (c *Console) WhohasCmdHandler(matches []string) error {
+	query := versionQuery.FindStringSubmatch(matches[1])
+	if query == nil {
+		return fmt.Errorf("incorrect query, expected: name [<|<=|=|!=|>=|> version]")
+	}
+	name, operator, version := query[1], query[2], query[3]
+	inventories, err := c.srv.Inventories()
+	if err != nil {
+		return err
+	}
+	online := make(map[string]bool)
+	for _, bot := range c.srv.ListBots() {
+		online[bot.ID] = true
+	}
+	botIds := make([]string, 0, len(inventories))
+	for botId := range inventories {
+		botIds = append(botIds, botId)
+	}
+	sort.Strings(botIds)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "BOT\tSTATE\tVERSION\tARCH\tUPDATE\tCOLLECTED")
+	found := 0
+	for _, botId := range botIds {
+		inventory := inventories[botId]
+		updates := make(map[string]string)
+		for _, update := range inventory.Updates {
+			updates[update.Name] = update.Available
+		}
+		for _, pkg := range inventory.Find(name) {
+			if operator != "" && !versionOperators[operator](inventory.CompareVersions(pkg.Version, version)) {
+				continue
+			}
+			botName, state, update := botId, "offline", updates[pkg.Name]
+			if alias := c.getAlias(botId); alias != "" {
+				botName = alias
+			}
+			if online[botId] {
+				state = "online"
+			}
+			if update == "" {
+				update = "-"
+			}
+			_, _ = fmt.Fprintf(
+				w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				botName, state, pkg.Version, pkg.Arch, update, inventory.CollectedAt.Local().Format("2006-01-02 15:04"),
+			)
+			found++
+		}
+	}
+	if found == 0 {
+		color.HiYellow("no bots found among %d inventories", len(inventories))
+		return nil
+	}
+	return w.Flush()
+}
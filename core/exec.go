@@ -0,0 +1,54 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MaxExecOutputSize limits each output stream kept in ExecResult. The full
+// output is still delivered with chunks.
+const MaxExecOutputSize = 1 << 20
+
+// ExecOptions changes the credentials and the context of the executed
+// process. Env entries are in the "KEY=value" form.
+type ExecOptions struct {
+	User  string   `json:"user,omitempty"`
+	Group string   `json:"group,omitempty"`
+	Cwd   string   `json:"cwd,omitempty"`
+	Env   []string `json:"env,omitempty"`
+	Umask *uint32  `json:"umask,omitempty"`
+}
+
+// ExecResult describes the executed process. Error is set only if the
+// process hasn't been started at all.
+type ExecResult struct {
+	ExitCode        int       `json:"exit_code"`
+	Signal          string    `json:"signal,omitempty"`
+	Stdout          string    `json:"stdout"`
+	Stderr          string    `json:"stderr"`
+	StdoutTruncated bool      `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool      `json:"stderr_truncated,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	Error           string    `json:"error,omitempty"`
+}
+
+func (r *ExecResult) Started() bool {
+	return r.Error == ""
+}
+
+func (r *ExecResult) Succeeded() bool {
+	return r.Started() && r.Signal == "" && r.ExitCode == 0
+}
+
+func (r *ExecResult) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+func ParseExecResult(data []byte) (*ExecResult, error) {
+	result := new(ExecResult)
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,43 @@
+package core
+
+import "time"
+
+// Version is the version of the agent reported in the host facts.
+const Version = "0.2.0"
+
+// HostFacts describes the bot host, the bot sends them in the hello
+// message after connecting and on demand.
+type HostFacts struct {
+	Hostname     string           `json:"hostname"`
+	OS           string           `json:"os"`
+	OSID         string           `json:"os_id"`
+	OSVersion    string           `json:"os_version"`
+	Kernel       string           `json:"kernel"`
+	Arch         string           `json:"arch"`
+	CPUs         int              `json:"cpus"`
+	CPUModel     string           `json:"cpu_model,omitempty"`
+	MemoryTotal  uint64           `json:"memory_total"`
+	Disks        []DiskFacts      `json:"disks"`
+	Interfaces   []InterfaceFacts `json:"interfaces"`
+	AgentVersion string           `json:"agent_version"`
+	Uptime       time.Duration    `json:"uptime"`
+	CollectedAt  time.Time        `json:"collected_at"`
+}
+
+type DiskFacts struct {
+	Device string `json:"device"`
+	Mount  string `json:"mount"`
+	FSType string `json:"fs_type"`
+	Total  uint64 `json:"total"`
+	Free   uint64 `json:"free"`
+}
+
+type InterfaceFacts struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
+func NewHelloMessage(facts *HostFacts) *Message {
+	return &Message{Type: MessageTypeHello, Facts: facts}
+}
@@ -0,0 +1,86 @@
+package core
+
+import "time"
+
+const (
+	// MaxCatSize is the max number of bytes returned by the cat command.
+	MaxCatSize = 1 << 20
+	// DefaultFindLimit is the max number of files returned by the find
+	// command if the request has no limit.
+	DefaultFindLimit = 1000
+)
+
+const (
+	FileTypeRegular = "f"
+	FileTypeDir     = "d"
+	FileTypeSymlink = "l"
+)
+
+type FileInfo struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Mode    string    `json:"mode"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Uid     uint32    `json:"uid"`
+	Gid     uint32    `json:"gid"`
+	Owner   string    `json:"owner,omitempty"`
+	Group   string    `json:"group,omitempty"`
+	Link    string    `json:"link,omitempty"`
+}
+
+func (i *FileInfo) IsDir() bool {
+	return i.Type == FileTypeDir
+}
+
+type ListResult struct {
+	Path  string      `json:"path"`
+	Files []*FileInfo `json:"files"`
+}
+
+// CatRequest reads Length bytes from Offset, zero length means the rest
+// of the file up to MaxCatSize.
+type CatRequest struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+type CatResult struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Data   []byte `json:"data"`
+}
+
+// FindRequest filters files by the glob of their name, the type and the
+// size, zero max size means no limit.
+type FindRequest struct {
+	Path     string `json:"path"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	MinSize  int64  `json:"min_size,omitempty"`
+	MaxSize  int64  `json:"max_size,omitempty"`
+	MaxDepth int    `json:"max_depth,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type FindResult struct {
+	Files     []*FileInfo `json:"files"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+type ChecksumResult struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// TailRequest follows the file printing Lines last lines first, the lines
+// not matching the Filter regexp are skipped.
+type TailRequest struct {
+	Path   string `json:"path"`
+	Lines  int    `json:"lines"`
+	Filter string `json:"filter,omitempty"`
+}
@@ -0,0 +1,81 @@
+package core
+
+type MessageType string
+
+const (
+	MessageTypeCommand MessageType = "command"
+	MessageTypeResult  MessageType = "result"
+	MessageTypeChunk   MessageType = "chunk"
+	MessageTypeCancel  MessageType = "cancel"
+	MessageTypeHello   MessageType = "hello"
+	MessageTypeMetrics MessageType = "metrics"
+
+	MessageTypePTYData   MessageType = "pty_data"
+	MessageTypePTYResize MessageType = "pty_resize"
+
+	MessageTypeUploadAck  MessageType = "upload_ack"
+	MessageTypeUploadData MessageType = "upload_data"
+
+	MessageTypeDownloadData MessageType = "download_data"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Message is the envelope of everything sent over the bot websocket
+// connection in both directions.
+type Message struct {
+	Type     MessageType    `json:"type"`
+	Command  *Command       `json:"command,omitempty"`
+	Result   *Result        `json:"result,omitempty"`
+	Chunk    *Chunk         `json:"chunk,omitempty"`
+	Cancel   *Cancel        `json:"cancel,omitempty"`
+	PTY      *PTYFrame      `json:"pty,omitempty"`
+	Transfer *TransferChunk `json:"transfer,omitempty"`
+	Facts    *HostFacts     `json:"facts,omitempty"`
+	Metrics  *Metrics       `json:"metrics,omitempty"`
+}
+
+type Result struct {
+	CommandID string `json:"command_id"`
+	Code      string `json:"code"`
+	Data      []byte `json:"data"`
+}
+
+// Chunk is a piece of command output sent while the command is still
+// running. Seq numbers are consecutive within a command across all streams.
+type Chunk struct {
+	CommandID string `json:"command_id"`
+	Stream    string `json:"stream"`
+	Seq       uint64 `json:"seq"`
+	Data      []byte `json:"data"`
+}
+
+// Cancel asks the bot to interrupt the running command.
+type Cancel struct {
+	CommandID string `json:"command_id"`
+}
+
+func NewCommandMessage(cmd *Command) *Message {
+	return &Message{Type: MessageTypeCommand, Command: cmd}
+}
+
+func NewResultMessage(commandId, code string, data []byte) *Message {
+	return &Message{
+		Type:   MessageTypeResult,
+		Result: &Result{CommandID: commandId, Code: code, Data: data},
+	}
+}
+
+func NewChunkMessage(commandId, stream string, seq uint64, data []byte) *Message {
+	return &Message{
+		Type:  MessageTypeChunk,
+		Chunk: &Chunk{CommandID: commandId, Stream: stream, Seq: seq, Data: data},
+	}
+}
+
+func NewCancelMessage(commandId string) *Message {
+	return &Message{Type: MessageTypeCancel, Cancel: &Cancel{CommandID: commandId}}
+}
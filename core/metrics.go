@@ -0,0 +1,24 @@
+package core
+
+import "time"
+
+// Metrics is the sample of the bot host counters pushed periodically. The
+// rates are computed over the time since the previous sample.
+type Metrics struct {
+	Time          time.Time   `json:"time"`
+	CPUPercent    float64     `json:"cpu_percent"`
+	Load          [3]float64  `json:"load"`
+	MemoryTotal   uint64      `json:"memory_total"`
+	MemoryUsed    uint64      `json:"memory_used"`
+	SwapTotal     uint64      `json:"swap_total"`
+	SwapUsed      uint64      `json:"swap_used"`
+	Disks         []DiskFacts `json:"disks"`
+	DiskReadRate  float64     `json:"disk_read_rate"`
+	DiskWriteRate float64     `json:"disk_write_rate"`
+	NetRxRate     float64     `json:"net_rx_rate"`
+	NetTxRate     float64     `json:"net_tx_rate"`
+}
+
+func NewMetricsMessage(metrics *Metrics) *Message {
+	return &Message{Type: MessageTypeMetrics, Metrics: metrics}
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PackageManagerDpkg = "dpkg"
+	PackageManagerRPM  = "rpm"
+)
+
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch,omitempty"`
+}
+
+type PackageUpdate struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Available string `json:"available"`
+}
+
+// Inventory contains the installed packages and the updates known to the
+// package manager caches of the bot host.
+type Inventory struct {
+	Manager      string          `json:"manager"`
+	Packages     []Package       `json:"packages"`
+	Updates      []PackageUpdate `json:"updates"`
+	UpdatesError string          `json:"updates_error,omitempty"`
+	CollectedAt  time.Time       `json:"collected_at"`
+}
+
+// Find returns the installed packages with the name, there may be several
+// of them with different architectures.
+func (inv *Inventory) Find(name string) []Package {
+	var found []Package
+	for _, pkg := range inv.Packages {
+		if pkg.Name == name {
+			found = append(found, pkg)
+		}
+	}
+	return found
+}
+
+// CompareVersions compares the package versions by the rules of the
+// inventory package manager.
+func (inv *Inventory) CompareVersions(a, b string) int {
+	if inv.Manager == PackageManagerRPM {
+		return CompareRPMVersions(a, b)
+	}
+	return CompareDpkgVersions(a, b)
+}
+
+// CompareDpkgVersions compares the [epoch:]upstream[-revision] versions
+// like dpkg does.
+func CompareDpkgVersions(a, b string) int {
+	epochA, upstreamA, revisionA := splitVersion(a)
+	epochB, upstreamB, revisionB := splitVersion(b)
+	if epochA != epochB {
+		if epochA < epochB {
+			return -1
+		}
+		return 1
+	}
+	if result := compareVersionPart(upstreamA, upstreamB); result != 0 {
+		return result
+	}
+	return compareVersionPart(revisionA, revisionB)
+}
+
+// CompareRPMVersions compares the [epoch:]version[-release] versions like
+// rpm does, the release is compared only if both versions have it.
+func CompareRPMVersions(a, b string) int {
+	epochA, versionA, releaseA := splitVersion(a)
+	epochB, versionB, releaseB := splitVersion(b)
+	if epochA != epochB {
+		if epochA < epochB {
+			return -1
+		}
+		return 1
+	}
+	if result := rpmvercmp(versionA, versionB); result != 0 || releaseA == "" || releaseB == "" {
+		return result
+	}
+	return rpmvercmp(releaseA, releaseB)
+}
+
+func splitVersion(version string) (epoch int, upstream, revision string) {
+	upstream = version
+	if colon := strings.IndexByte(upstream, ':'); colon >= 0 {
+		if n, err := strconv.Atoi(upstream[:colon]); err == nil {
+			epoch, upstream = n, upstream[colon+1:]
+		}
+	}
+	if dash := strings.LastIndexByte(upstream, '-'); dash >= 0 {
+		upstream, revision = upstream[:dash], upstream[dash+1:]
+	}
+	return epoch, upstream, revision
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// versionCharOrder sorts "~" before anything, even the end of the part,
+// and letters before the other characters.
+func versionCharOrder(s string) int {
+	if s == "" {
+		return 0
+	}
+	c := s[0]
+	switch {
+	case c == '~':
+		return -1
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+func compareVersionPart(a, b string) int {
+	for a != "" || b != "" {
+		for a != "" && !isDigit(a[0]) || b != "" && !isDigit(b[0]) {
+			orderA, orderB := versionCharOrder(a), versionCharOrder(b)
+			if orderA != orderB {
+				if orderA < orderB {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[1:], b[1:]
+		}
+		var numberA, numberB string
+		numberA, a = splitNumber(a)
+		numberB, b = splitNumber(b)
+		if len(numberA) != len(numberB) {
+			if len(numberA) < len(numberB) {
+				return -1
+			}
+			return 1
+		}
+		if numberA != numberB {
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// splitNumber returns the leading number without zeros and the rest.
+func splitNumber(s string) (number, rest string) {
+	end := 0
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	return strings.TrimLeft(s[:end], "0"), s[end:]
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// rpmvercmp compares the alphanumeric segments ignoring the separators,
+// "~" sorts before anything and "^" sorts after the end of the version
+// but before any other segment.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSeparator := func(c byte) bool {
+		return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^'
+	}
+	for a != "" || b != "" {
+		for a != "" && isSeparator(a[0]) {
+			a = a[1:]
+		}
+		for b != "" && isSeparator(b[0]) {
+			b = b[1:]
+		}
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			switch {
+			case a == "":
+				return -1
+			case b == "":
+				return 1
+			case a[0] != '^':
+				return 1
+			case b[0] != '^':
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		isSegment, numeric := isAlpha, isDigit(a[0])
+		if numeric {
+			isSegment = isDigit
+		}
+		var segmentA, segmentB string
+		segmentA, a = splitSegment(a, isSegment)
+		segmentB, b = splitSegment(b, isSegment)
+		// the numeric segment is newer than the alphabetic one
+		if segmentB == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			segmentA, segmentB = strings.TrimLeft(segmentA, "0"), strings.TrimLeft(segmentB, "0")
+			if len(segmentA) != len(segmentB) {
+				if len(segmentA) < len(segmentB) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if segmentA != segmentB {
+			if segmentA < segmentB {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+func splitSegment(s string, isSegment func(c byte) bool) (segment, rest string) {
+	end := 0
+	for end < len(s) && isSegment(s[end]) {
+		end++
+	}
+	return s[:end], s[end:]
+}
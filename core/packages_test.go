@@ -0,0 +1,87 @@
+package core
+
+import "testing"
+
+func TestCompareDpkgVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.1", "1.0", 1},
+		{"2.10", "2.9", 1},
+		{"1.01", "1.1", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0.1", -1},
+		{"1.0+b1", "1.0", 1},
+		{"1.0.1", "1.0_1", -1},
+		{"1:0.9", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1.0", "1.0-0", 0},
+		{"1.1.1f-1ubuntu2.16", "1.1.1f-1ubuntu2.9", 1},
+		{"1.2-3-4", "1.2-3-5", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareDpkgVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareDpkgVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompareRPMVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"2.10", "2.9", 1},
+		{"1.010", "1.10", 0},
+		{"1.0.1", "1.0_1", 0},
+		{"1.0.1", "1..0.1", 0},
+		{"1.0", "1.0.1", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0.1", -1},
+		{"1.0a", "1.0b", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0~rc1^git1", "1.0~rc1", 1},
+		{"1.0~rc1^git1", "1.0", -1},
+		{"1.0.2k", "1.0.2l", -1},
+		{"1:1.0", "2.0", 1},
+		{"1.0-1.el9", "1.0-2.el9", -1},
+		{"1.0-10.el9", "1.0-9.el9", 1},
+		{"1.0.2k-19.el7", "1.0.2k", 0},
+		{"1.0.2k", "1.0.2k-19.el7", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareRPMVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareRPMVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestInventoryCompareVersions(t *testing.T) {
+	tests := []struct {
+		manager string
+		want    int
+	}{
+		{PackageManagerDpkg, -1},
+		{PackageManagerRPM, 0},
+	}
+	for _, tt := range tests {
+		inventory := &Inventory{Manager: tt.manager}
+		if got := inventory.CompareVersions("1.0.1", "1.0_1"); got != tt.want {
+			t.Errorf("%s CompareVersions(%q, %q) = %d, want %d", tt.manager, "1.0.1", "1.0_1", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type Process struct {
+	PID        int           `json:"pid"`
+	PPID       int           `json:"ppid"`
+	UID        uint32        `json:"uid"`
+	User       string        `json:"user,omitempty"`
+	State      string        `json:"state"`
+	Name       string        `json:"name"`
+	Cmdline    string        `json:"cmdline"`
+	CPUTime    time.Duration `json:"cpu_time"`
+	CPUPercent float64       `json:"cpu_percent"`
+	RSS        uint64        `json:"rss"`
+	StartTime  time.Time     `json:"start_time"`
+}
+
+// Command returns the command line or the name of the kernel thread.
+func (p *Process) Command() string {
+	if p.Cmdline != "" {
+		return p.Cmdline
+	}
+	return "[" + p.Name + "]"
+}
+
+// Descendants returns the PIDs of the process children recursively, the
+// parents go before their children.
+func Descendants(processes []*Process, pid int) []int {
+	children := make(map[int][]int)
+	for _, p := range processes {
+		children[p.PPID] = append(children[p.PPID], p.PID)
+	}
+	var result []int
+	queue := children[pid]
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		result = append(result, next)
+		queue = append(queue, children[next]...)
+	}
+	return result
+}
+
+// KillRequest sends the signal to the confirmed processes, every target
+// is signaled only if its start time still matches, so the reused PIDs
+// are left alone.
+type KillRequest struct {
+	Signal  string       `json:"signal"`
+	Targets []KillTarget `json:"targets"`
+}
+
+type KillTarget struct {
+	PID       int       `json:"pid"`
+	StartTime time.Time `json:"start_time"`
+}
+
+type KillResult struct {
+	Signal   string   `json:"signal"`
+	Signaled []int    `json:"signaled"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// ParseSignal parses the signal name like TERM, SIGTERM or its number.
+func ParseSignal(name string) (syscall.Signal, error) {
+	if number, err := strconv.Atoi(name); err == nil {
+		if unix.SignalName(syscall.Signal(number)) == "" {
+			return 0, fmt.Errorf("unknown signal: %s", name)
+		}
+		return syscall.Signal(number), nil
+	}
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	signal := unix.SignalNum(name)
+	if signal == 0 {
+		return 0, fmt.Errorf("unknown signal: %s", name)
+	}
+	return signal, nil
+}
@@ -0,0 +1,31 @@
+package core
+
+// PTYRequest is the argument of the shell command.
+type PTYRequest struct {
+	Term string `json:"term"`
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// PTYFrame carries raw terminal bytes or the new window size of the PTY
+// session. The session ID is the ID of the shell command.
+type PTYFrame struct {
+	SessionID string `json:"session_id"`
+	Data      []byte `json:"data,omitempty"`
+	Rows      uint16 `json:"rows,omitempty"`
+	Cols      uint16 `json:"cols,omitempty"`
+}
+
+func NewPTYDataMessage(sessionId string, data []byte) *Message {
+	return &Message{
+		Type: MessageTypePTYData,
+		PTY:  &PTYFrame{SessionID: sessionId, Data: data},
+	}
+}
+
+func NewPTYResizeMessage(sessionId string, rows, cols uint16) *Message {
+	return &Message{
+		Type: MessageTypePTYResize,
+		PTY:  &PTYFrame{SessionID: sessionId, Rows: rows, Cols: cols},
+	}
+}
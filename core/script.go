@@ -0,0 +1,18 @@
+package core
+
+// ScriptInterpreters are the interpreters the script command may run.
+var ScriptInterpreters = []string{"sh", "bash", "python3", "perl"}
+
+// InterpreterShebang takes the interpreter from the script shebang line.
+const InterpreterShebang = "shebang"
+
+type ScriptRequest struct {
+	Interpreter string   `json:"interpreter"`
+	Body        string   `json:"body"`
+	Args        []string `json:"args,omitempty"`
+}
+
+type Interpreter struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
@@ -0,0 +1,53 @@
+package core
+
+import "time"
+
+const (
+	ServiceActionStatus  = "status"
+	ServiceActionStart   = "start"
+	ServiceActionStop    = "stop"
+	ServiceActionRestart = "restart"
+	ServiceActionEnable  = "enable"
+	ServiceActionDisable = "disable"
+	ServiceActionJournal = "journal"
+)
+
+var ServiceActions = []string{
+	ServiceActionStatus, ServiceActionStart, ServiceActionStop, ServiceActionRestart,
+	ServiceActionEnable, ServiceActionDisable, ServiceActionJournal,
+}
+
+const DefaultJournalLines = 20
+
+// ServiceRequest applies the action to the systemd units, the status of
+// all service units is returned if no units are given.
+type ServiceRequest struct {
+	Action string   `json:"action"`
+	Units  []string `json:"units,omitempty"`
+	Lines  int      `json:"lines,omitempty"`
+}
+
+type Unit struct {
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	LoadState     string    `json:"load_state"`
+	ActiveState   string    `json:"active_state"`
+	SubState      string    `json:"sub_state"`
+	UnitFileState string    `json:"unit_file_state,omitempty"`
+	MainPID       int       `json:"main_pid,omitempty"`
+	ActiveSince   time.Time `json:"active_since,omitempty"`
+}
+
+type JournalEntry struct {
+	Time     time.Time `json:"time"`
+	Unit     string    `json:"unit"`
+	PID      int       `json:"pid,omitempty"`
+	Priority int       `json:"priority"`
+	Message  string    `json:"message"`
+}
+
+type ServiceResult struct {
+	Action  string         `json:"action"`
+	Units   []Unit         `json:"units"`
+	Journal []JournalEntry `json:"journal,omitempty"`
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// TransferChunkSize is the max size of file data sent in one message.
+const TransferChunkSize = 64 * 1024
+
+// UploadRequest is the argument of the upload command. The file data is
+// sent by the server after the bot acknowledges the offset to start from.
+type UploadRequest struct {
+	Path   string  `json:"path"`
+	Size   int64   `json:"size"`
+	SHA256 string  `json:"sha256"`
+	Mode   *uint32 `json:"mode,omitempty"`
+	Owner  string  `json:"owner,omitempty"`
+	Group  string  `json:"group,omitempty"`
+}
+
+// DownloadRequest is the argument of the download command. The bot sends
+// the file data and then the result with the checksum of the sent data.
+type DownloadRequest struct {
+	Path    string `json:"path"`
+	MaxSize int64  `json:"max_size"`
+}
+
+// TransferChunk is a piece of the file transferred by the command. The
+// chunk without data acknowledges the offset the receiver expects next.
+type TransferChunk struct {
+	CommandID string `json:"command_id"`
+	Offset    int64  `json:"offset"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+type TransferResult struct {
+	Path        string `json:"path"`
+	Source      string `json:"source,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ResumedFrom int64  `json:"resumed_from,omitempty"`
+}
+
+func NewUploadAckMessage(commandId string, offset int64) *Message {
+	return &Message{
+		Type:     MessageTypeUploadAck,
+		Transfer: &TransferChunk{CommandID: commandId, Offset: offset},
+	}
+}
+
+func NewUploadDataMessage(commandId string, offset int64, data []byte) *Message {
+	return &Message{
+		Type:     MessageTypeUploadData,
+		Transfer: &TransferChunk{CommandID: commandId, Offset: offset, Data: data},
+	}
+}
+
+func NewDownloadDataMessage(commandId string, offset int64, data []byte) *Message {
+	return &Message{
+		Type:     MessageTypeDownloadData,
+		Transfer: &TransferChunk{CommandID: commandId, Offset: offset, Data: data},
+	}
+}
+
+// FileSHA256 returns the hex encoded SHA-256 of the file content.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -7,6 +7,6 @@ require (
 	github.com/google/uuid v1.1.5
 	github.com/gorilla/websocket v1.4.2
 	github.com/prologic/bitcask v0.3.10
-	golang.org/x/sys v0.0.0-20210113181707-4bcb84eeeb78 // indirect
+	golang.org/x/sys v0.0.0-20210113181707-4bcb84eeeb78
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 )
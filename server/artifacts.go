@@ -0,0 +1,286 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prologic/bitcask"
+	"github.com/xorium/wormwhole/core"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultArtifactDir   = "artifacts"
+	defaultArtifactQuota = 1 << 30
+	artifactPrefix       = "artifact:"
+	maxArtifactNameSize  = 128
+)
+
+var errArtifactQuotaExceeded = errors.New("artifact quota exceeded")
+
+// Artifact is the metadata of the file posted by the bot. The content is
+// stored once per bot by its checksum.
+type Artifact struct {
+	BotID     string    `json:"bot_id"`
+	Name      string    `json:"name"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ArtifactStore keeps the artifacts content under the root directory in
+// per-bot namespaces and indexes their metadata in the server database.
+type ArtifactStore struct {
+	*sync.Mutex
+	root  string
+	quota int64
+	db    *bitcask.Bitcask
+}
+
+func newArtifactStore(db *bitcask.Bitcask, root string, quota int64) *ArtifactStore {
+	return &ArtifactStore{Mutex: new(sync.Mutex), root: root, quota: quota, db: db}
+}
+
+// SetArtifactStore sets the root directory of the artifacts and the max
+// total size of the artifacts of one bot.
+func (s *CommandServer) SetArtifactStore(root string, quota int64) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if quota <= 0 {
+		return fmt.Errorf("incorrect artifact quota: %d", quota)
+	}
+	s.Lock()
+	s.artifacts = newArtifactStore(s.store, root, quota)
+	s.Unlock()
+	return nil
+}
+
+func (s *CommandServer) Artifacts() *ArtifactStore {
+	s.RLock()
+	defer s.RUnlock()
+	return s.artifacts
+}
+
+func artifactKey(botId, checksum string) []byte {
+	return []byte(artifactPrefix + botId + ":" + checksum)
+}
+
+// artifactName keeps the printable base name of the posted name, it's
+// never used as a path.
+func artifactName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, filepath.Base(name))
+	if name == "" || name == "." || name == "/" {
+		name = "unknown"
+	}
+	if len(name) > maxArtifactNameSize {
+		name = name[:maxArtifactNameSize]
+	}
+	return name
+}
+
+func (a *ArtifactStore) objectPath(botId, checksum string) (string, error) {
+	botDir, err := botDirPath(a.root, botId)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(botDir, checksum[:2], checksum), nil
+}
+
+// Put stores the content read from r if it fits the bot quota. The same
+// content is stored once, its name and time are updated.
+func (a *ArtifactStore) Put(botId, name string, r io.Reader) (*Artifact, error) {
+	botDir, err := botDirPath(a.root, botId)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(botDir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(botDir, ".incoming-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	// the content is read whole to find out if it's stored already
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, a.quota+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if size > a.quota {
+		return nil, errArtifactQuotaExceeded
+	}
+	artifact := &Artifact{
+		BotID:     botId,
+		Name:      artifactName(name),
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	if !a.db.Has(artifactKey(botId, artifact.SHA256)) {
+		usage, err := a.Usage(botId)
+		if err != nil {
+			return nil, err
+		}
+		if usage+size > a.quota {
+			return nil, errArtifactQuotaExceeded
+		}
+		path, err := a.objectPath(botId, artifact.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return nil, err
+		}
+	}
+	value, err := json.Marshal(artifact)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.db.Put(artifactKey(botId, artifact.SHA256), value); err != nil {
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// List returns the bot artifacts sorted by time.
+func (a *ArtifactStore) List(botId string) ([]*Artifact, error) {
+	var keys [][]byte
+	err := a.db.Scan([]byte(artifactPrefix+botId+":"), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	artifacts := make([]*Artifact, 0, len(keys))
+	for _, key := range keys {
+		value, err := a.db.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		artifact := new(Artifact)
+		if err := json.Unmarshal(value, artifact); err != nil {
+			return nil, fmt.Errorf("incorrect artifact %s: %v", key, err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].CreatedAt.Before(artifacts[j].CreatedAt)
+	})
+	return artifacts, nil
+}
+
+// Usage returns the total size of the bot artifacts.
+func (a *ArtifactStore) Usage(botId string) (int64, error) {
+	artifacts, err := a.List(botId)
+	if err != nil {
+		return 0, err
+	}
+	var usage int64
+	for _, artifact := range artifacts {
+		usage += artifact.Size
+	}
+	return usage, nil
+}
+
+// Find returns the bot artifact by the unique checksum prefix.
+func (a *ArtifactStore) Find(botId, prefix string) (*Artifact, error) {
+	artifacts, err := a.List(botId)
+	if err != nil {
+		return nil, err
+	}
+	var found *Artifact
+	for _, artifact := range artifacts {
+		if !strings.HasPrefix(artifact.SHA256, prefix) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("ambiguous artifact checksum prefix %s", prefix)
+		}
+		found = artifact
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown artifact %s", prefix)
+	}
+	return found, nil
+}
+
+func (a *ArtifactStore) Open(artifact *Artifact) (*os.File, error) {
+	path, err := a.objectPath(artifact.BotID, artifact.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// reccon stores the artifact posted by the enrolled bot.
+func (s *CommandServer) reccon(w http.ResponseWriter, r *http.Request) {
+	certName, err := s.peerName(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	botId := query.Get("uuid")
+	if !s.authenticate(botId, r.Header.Get(core.CredentialHeader)) {
+		if s.Debug {
+			log.Printf("rejected artifact of bot %q from %s\n", botId, r.RemoteAddr)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := s.verifyPeer(botId, certName); err != nil {
+		log.Printf("rejected artifact of bot %s from %s: %v\n", botId, r.RemoteAddr, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	artifact, err := s.Artifacts().Put(botId, query.Get("n"), r.Body)
+	if err == errArtifactQuotaExceeded {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("error while storing artifact of bot %s: %v\n", botId, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write([]byte(artifact.SHA256))
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOtherBotId = "6ba7b811-9dad-11d1-80b4-00c04fd430c8"
+
+func newTestArtifactStore(t *testing.T, quota int64) *ArtifactStore {
+	s := newTestServer(t)
+	if err := s.SetArtifactStore(t.TempDir(), quota); err != nil {
+		t.Fatal(err)
+	}
+	return s.Artifacts()
+}
+
+func TestArtifactPutRejectsTraversalIds(t *testing.T) {
+	a := newTestArtifactStore(t, 1024)
+	for _, botId := range []string{
+		"",
+		"..",
+		"evil/../" + testBotId,
+		"../" + testBotId,
+		testBotId + "/..",
+		"/" + testBotId,
+		testBotId + ":x",
+	} {
+		if _, err := a.Put(botId, "report.txt", strings.NewReader("content")); err == nil {
+			t.Errorf("Put of bot %q succeeded", botId)
+		}
+	}
+	entries, err := ioutil.ReadDir(a.root)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("artifact root isn't empty: %d entries", len(entries))
+	}
+}
+
+func TestArtifactPutStoresInBotNamespace(t *testing.T) {
+	a := newTestArtifactStore(t, 1024)
+	artifact, err := a.Put(testBotId, "../../report.txt", strings.NewReader("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact.Name != "report.txt" || artifact.Size != int64(len("content")) {
+		t.Errorf("artifact %+v", artifact)
+	}
+	path := filepath.Join(a.root, testBotId, artifact.SHA256[:2], artifact.SHA256)
+	if content, err := ioutil.ReadFile(path); err != nil || string(content) != "content" {
+		t.Errorf("artifact content %q, %v", content, err)
+	}
+	if artifacts, err := a.List(testOtherBotId); err != nil || len(artifacts) != 0 {
+		t.Errorf("other bot artifacts %v, %v", artifacts, err)
+	}
+}
+
+func TestArtifactQuota(t *testing.T) {
+	a := newTestArtifactStore(t, 10)
+	if _, err := a.Put(testBotId, "a", strings.NewReader("123456")); err != nil {
+		t.Fatal(err)
+	}
+	// the same content is stored once
+	if _, err := a.Put(testBotId, "b", strings.NewReader("123456")); err != nil {
+		t.Fatalf("Put of stored content: %v", err)
+	}
+	if _, err := a.Put(testBotId, "c", strings.NewReader("abcdef")); err != errArtifactQuotaExceeded {
+		t.Errorf("Put over quota error %v, want %v", err, errArtifactQuotaExceeded)
+	}
+	if _, err := a.Put(testBotId, "d", strings.NewReader("abcd")); err != nil {
+		t.Errorf("Put up to quota: %v", err)
+	}
+	if usage, err := a.Usage(testBotId); err != nil || usage != 10 {
+		t.Errorf("usage %d, %v, want 10", usage, err)
+	}
+	// the quota is per bot
+	if _, err := a.Put(testOtherBotId, "e", strings.NewReader("abcdef")); err != nil {
+		t.Errorf("Put of other bot: %v", err)
+	}
+
+	incoming, err := filepath.Glob(filepath.Join(a.root, "*", ".incoming-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incoming) != 0 {
+		t.Errorf("incoming files are left: %v", incoming)
+	}
+}
@@ -9,3 +9,67 @@ func ExecCommand(cmd string) *core.Command {
 func PingCommand() *core.Command {
 	return core.NewCommand("ping")
 }
+
+func ShellCommand(term string, rows, cols uint16) *core.Command {
+	return core.NewCommand("shell", core.PTYRequest{Term: term, Rows: rows, Cols: cols})
+}
+
+func ScriptCommand(interpreter, body string, args []string) *core.Command {
+	return core.NewCommand("script", core.ScriptRequest{Interpreter: interpreter, Body: body, Args: args})
+}
+
+func InterpretersCommand() *core.Command {
+	return core.NewCommand("interpreters")
+}
+
+func UploadCommand(req core.UploadRequest) *core.Command {
+	return core.NewCommand("upload", req)
+}
+
+func DownloadCommand(req core.DownloadRequest) *core.Command {
+	return core.NewCommand("download", req)
+}
+
+func LsCommand(path string) *core.Command {
+	return core.NewCommand("ls", path)
+}
+
+func StatCommand(path string) *core.Command {
+	return core.NewCommand("stat", path)
+}
+
+func CatCommand(req core.CatRequest) *core.Command {
+	return core.NewCommand("cat", req)
+}
+
+func FindCommand(req core.FindRequest) *core.Command {
+	return core.NewCommand("find", req)
+}
+
+func Sha256Command(path string) *core.Command {
+	return core.NewCommand("sha256", path)
+}
+
+func TailCommand(req core.TailRequest) *core.Command {
+	return core.NewCommand("tail", req)
+}
+
+func FactsCommand() *core.Command {
+	return core.NewCommand("facts")
+}
+
+func PsCommand() *core.Command {
+	return core.NewCommand("ps")
+}
+
+func KillCommand(req core.KillRequest) *core.Command {
+	return core.NewCommand("kill", req)
+}
+
+func ServiceCommand(req core.ServiceRequest) *core.Command {
+	return core.NewCommand("service", req)
+}
+
+func PackagesCommand() *core.Command {
+	return core.NewCommand("packages")
+}
@@ -0,0 +1,18 @@
+package server
+
+import "sync/atomic"
+
+// Counters holds server statistics. The fields must be accessed atomically.
+type Counters struct {
+	RejectedResults uint64
+}
+
+func (c *Counters) addRejectedResult() {
+	atomic.AddUint64(&c.RejectedResults, 1)
+}
+
+func (s *CommandServer) Counters() Counters {
+	return Counters{
+		RejectedResults: atomic.LoadUint64(&s.counters.RejectedResults),
+	}
+}
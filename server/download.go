@@ -0,0 +1,220 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"hash"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultDownloadDir     = "downloads"
+	defaultMaxDownloadSize = 1 << 30
+)
+
+// download is the bot file received by the download command into the
+// partial file, which is renamed to the target path once the checksum is
+// verified.
+type download struct {
+	*sync.Mutex
+	source  string
+	path    string
+	partial *os.File
+	hash    hash.Hash
+	size    int64
+	maxSize int64
+	err     error
+}
+
+// SetDownloadDir sets the directory the downloaded files are stored in,
+// every bot has its own subdirectory.
+func (s *CommandServer) SetDownloadDir(dir string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	s.downloadDir = root
+	s.Unlock()
+	return nil
+}
+
+// safePath joins the relative name to the root and checks that the result
+// doesn't escape the root.
+func safePath(root, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("relative path is expected: %q", name)
+	}
+	path := filepath.Join(root, name)
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside of %s", name, root)
+	}
+	return path, nil
+}
+
+// botDirPath returns the directory of the bot under the root, the bot ID
+// must be a single path segment.
+func botDirPath(root, botId string) (string, error) {
+	if !validBotId(botId) {
+		return "", fmt.Errorf("incorrect bot id: %q", botId)
+	}
+	return filepath.Join(root, botId), nil
+}
+
+// NewDownload creates the command downloading the bot file into the local
+// name relative to the bot download directory.
+func (s *CommandServer) NewDownload(bot *Bot, remotePath, localName string) (*core.Command, error) {
+	s.RLock()
+	root, maxSize := s.downloadDir, s.MaxDownloadSize
+	s.RUnlock()
+	botDir, err := botDirPath(root, bot.ID)
+	if err != nil {
+		return nil, err
+	}
+	path, err := safePath(botDir, localName)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	cmd := DownloadCommand(core.DownloadRequest{Path: remotePath, MaxSize: maxSize})
+	partialPath := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%s.part", filepath.Base(path), cmd.ID))
+	partial, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	s.downloads[cmd.ID] = &download{
+		Mutex:   new(sync.Mutex),
+		source:  remotePath,
+		path:    path,
+		partial: partial,
+		hash:    sha256.New(),
+		maxSize: maxSize,
+	}
+	s.Unlock()
+	return cmd, nil
+}
+
+func (s *CommandServer) handleDownloadData(bot *Bot, chunk *core.TransferChunk) {
+	if _, ok := s.botCommand(bot, chunk.CommandID); !ok {
+		return
+	}
+	s.RLock()
+	d, ok := s.downloads[chunk.CommandID]
+	s.RUnlock()
+	if !ok {
+		return
+	}
+	if err := d.write(chunk); err != nil {
+		log.Printf("download %s from bot %s error: %v\n", chunk.CommandID, bot.String(), err)
+		if err := bot.send(core.NewCancelMessage(chunk.CommandID)); err != nil && s.Debug {
+			log.Println("error while cancelling download: ", err)
+		}
+	}
+}
+
+// write returns the error only once, further chunks are ignored.
+func (d *download) write(chunk *core.TransferChunk) error {
+	d.Lock()
+	defer d.Unlock()
+	if d.err != nil {
+		return nil
+	}
+	switch {
+	case chunk.Offset != d.size:
+		d.err = fmt.Errorf("unexpected chunk offset %d, %d bytes received", chunk.Offset, d.size)
+	case d.size+int64(len(chunk.Data)) > d.maxSize:
+		d.err = fmt.Errorf("file exceeds the download size limit of %d bytes", d.maxSize)
+	default:
+		n, err := d.partial.Write(chunk.Data)
+		d.hash.Write(chunk.Data[:n])
+		d.size += int64(n)
+		d.err = err
+	}
+	return d.err
+}
+
+// finish verifies the received file against the bot result and returns
+// the result of the command.
+func (d *download) finish(respCode string, respBody []byte) (string, []byte) {
+	d.Lock()
+	defer d.Unlock()
+	defer d.remove()
+	if d.err != nil {
+		return core.CommandResultCodeError, []byte(d.err.Error())
+	}
+	if respCode != core.CommandResultCodeSuccess {
+		return respCode, respBody
+	}
+	var result core.TransferResult
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return core.CommandResultCodeError, []byte(fmt.Sprintf("incorrect download result: %v", err))
+	}
+	checksum := hex.EncodeToString(d.hash.Sum(nil))
+	if result.Size != d.size || result.SHA256 != checksum {
+		return core.CommandResultCodeError, []byte(fmt.Sprintf(
+			"checksum mismatch: bot sent %d bytes with sha256 %s, received %d bytes with sha256 %s",
+			result.Size, result.SHA256, d.size, checksum,
+		))
+	}
+	if err := d.partial.Close(); err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	if err := os.Rename(d.partial.Name(), d.path); err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	resp, err := json.Marshal(&core.TransferResult{
+		Path:   d.path,
+		Source: d.source,
+		Size:   d.size,
+		SHA256: checksum,
+	})
+	if err != nil {
+		return core.CommandResultCodeError, []byte(err.Error())
+	}
+	return core.CommandResultCodeSuccess, resp
+}
+
+// remove closes and removes the partial file if it hasn't been renamed.
+func (d *download) remove() {
+	_ = d.partial.Close()
+	if err := os.Remove(d.partial.Name()); err != nil && !os.IsNotExist(err) {
+		log.Println("error while removing partial download: ", err)
+	}
+}
+
+// finishDownload replaces the result of the download command with the
+// result of storing the file.
+func (s *CommandServer) finishDownload(cmdId, respCode string, respBody []byte) (string, []byte) {
+	s.Lock()
+	d, ok := s.downloads[cmdId]
+	delete(s.downloads, cmdId)
+	s.Unlock()
+	if !ok {
+		return respCode, respBody
+	}
+	return d.finish(respCode, respBody)
+}
+
+func (s *CommandServer) abortDownload(cmdId string) {
+	s.Lock()
+	d, ok := s.downloads[cmdId]
+	delete(s.downloads, cmdId)
+	s.Unlock()
+	if ok {
+		d.Lock()
+		d.remove()
+		d.Unlock()
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/xorium/wormwhole/core"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testBotId = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+func newTestServer(t *testing.T) *CommandServer {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return NewCommandServer("127.0.0.1:0", store)
+}
+
+func TestSafePath(t *testing.T) {
+	root := "/srv/downloads"
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"file.txt", "/srv/downloads/file.txt", true},
+		{"dir/file.txt", "/srv/downloads/dir/file.txt", true},
+		{"dir/../file.txt", "/srv/downloads/file.txt", true},
+		{"", "", false},
+		{".", "", false},
+		{"..", "", false},
+		{"../file.txt", "", false},
+		{"dir/../../file.txt", "", false},
+		{"/etc/passwd", "", false},
+		{"evil/../" + testBotId + "/file.txt", "/srv/downloads/" + testBotId + "/file.txt", true},
+	}
+	for _, tt := range tests {
+		got, err := safePath(root, tt.name)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("safePath(%q, %q) = %q, %v, want %q, ok %v", root, tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBotDirPath(t *testing.T) {
+	root := "/srv/downloads"
+	tests := []struct {
+		botId string
+		ok    bool
+	}{
+		{testBotId, true},
+		{"", false},
+		{"..", false},
+		{"evil/../" + testBotId, false},
+		{testBotId + "/..", false},
+		{"/" + testBotId, false},
+		{"urn:uuid:" + testBotId, false},
+		{"{" + testBotId + "}", false},
+	}
+	for _, tt := range tests {
+		got, err := botDirPath(root, tt.botId)
+		if (err == nil) != tt.ok {
+			t.Errorf("botDirPath(%q, %q) = %q, %v, want ok %v", root, tt.botId, got, err, tt.ok)
+		}
+		if tt.ok && got != filepath.Join(root, tt.botId) {
+			t.Errorf("botDirPath(%q, %q) = %q", root, tt.botId, got)
+		}
+	}
+}
+
+func newTestDownload(t *testing.T, s *CommandServer, localName string) (*core.Command, string) {
+	root := t.TempDir()
+	if err := s.SetDownloadDir(root); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := s.NewDownload(&Bot{ID: testBotId}, "/var/log/syslog", localName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd, filepath.Join(root, testBotId)
+}
+
+func transferResult(t *testing.T, data []byte) []byte {
+	sum := sha256.Sum256(data)
+	result, err := json.Marshal(&core.TransferResult{Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func partialFiles(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.part"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestNewDownloadRejectsOutsideNames(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.SetDownloadDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../syslog", "/tmp/syslog", "."} {
+		if _, err := s.NewDownload(&Bot{ID: testBotId}, "/var/log/syslog", name); err == nil {
+			t.Errorf("NewDownload(%q) succeeded", name)
+		}
+	}
+	if _, err := s.NewDownload(&Bot{ID: "evil/../" + testBotId}, "/var/log/syslog", "syslog"); err == nil {
+		t.Error("NewDownload of bot with separators in ID succeeded")
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	s := newTestServer(t)
+	cmd, botDir := newTestDownload(t, s, "logs/syslog")
+	data := []byte("first line\nsecond line\n")
+	for _, chunk := range []*core.TransferChunk{
+		{CommandID: cmd.ID, Offset: 0, Data: data[:10]},
+		{CommandID: cmd.ID, Offset: 10, Data: data[10:]},
+	} {
+		if err := s.downloads[cmd.ID].write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, resp := s.finishDownload(cmd.ID, core.CommandResultCodeSuccess, transferResult(t, data))
+	if code != core.CommandResultCodeSuccess {
+		t.Fatalf("download result %s: %s", code, resp)
+	}
+	path := filepath.Join(botDir, "logs", "syslog")
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(data) {
+		t.Errorf("downloaded %q, want %q", content, data)
+	}
+	var result core.TransferResult
+	if err := json.Unmarshal(resp, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != path || result.Size != int64(len(data)) {
+		t.Errorf("download result %+v", result)
+	}
+	if partial := partialFiles(t, filepath.Dir(path)); len(partial) != 0 {
+		t.Errorf("partial files are left: %v", partial)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	s := newTestServer(t)
+	cmd, botDir := newTestDownload(t, s, "syslog")
+	if err := s.downloads[cmd.ID].write(&core.TransferChunk{CommandID: cmd.ID, Data: []byte("received")}); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := s.finishDownload(cmd.ID, core.CommandResultCodeSuccess, transferResult(t, []byte("sent")))
+	if code != core.CommandResultCodeError {
+		t.Errorf("download result %s, want %s", code, core.CommandResultCodeError)
+	}
+	if _, err := os.Stat(filepath.Join(botDir, "syslog")); !os.IsNotExist(err) {
+		t.Errorf("file with wrong checksum is stored: %v", err)
+	}
+	if partial := partialFiles(t, botDir); len(partial) != 0 {
+		t.Errorf("partial files are left: %v", partial)
+	}
+}
+
+func TestDownloadUnexpectedOffset(t *testing.T) {
+	s := newTestServer(t)
+	cmd, botDir := newTestDownload(t, s, "syslog")
+	d := s.downloads[cmd.ID]
+	if err := d.write(&core.TransferChunk{CommandID: cmd.ID, Offset: 5, Data: []byte("data")}); err == nil {
+		t.Error("chunk with unexpected offset is written")
+	}
+
+	code, _ := s.finishDownload(cmd.ID, core.CommandResultCodeSuccess, transferResult(t, []byte("data")))
+	if code != core.CommandResultCodeError {
+		t.Errorf("download result %s, want %s", code, core.CommandResultCodeError)
+	}
+	if _, err := os.Stat(filepath.Join(botDir, "syslog")); !os.IsNotExist(err) {
+		t.Errorf("incomplete file is stored: %v", err)
+	}
+}
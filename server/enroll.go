@@ -0,0 +1,208 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/prologic/bitcask"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	joinTokenTTL       = 24 * time.Hour
+	joinTokenPrefix    = "jointoken:"
+	credentialPrefix   = "credential:"
+	certNamePrefix     = "certname:"
+	credentialSecretSz = 32
+)
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// CreateJoinToken mints a one-time token the bot exchanges for its
+// long-lived credential.
+func (s *CommandServer) CreateJoinToken() (string, error) {
+	token, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(joinTokenTTL).Unix()
+	err = s.store.Put(
+		[]byte(joinTokenPrefix+token), []byte(strconv.FormatInt(expiresAt, 10)),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+var (
+	errAlreadyEnrolled  = fmt.Errorf("already enrolled")
+	errUnknownJoinToken = fmt.Errorf("unknown join token")
+	errExpiredJoinToken = fmt.Errorf("join token has been expired")
+)
+
+// useJoinToken must be called with the server lock held.
+func (s *CommandServer) useJoinToken(token string) error {
+	key := []byte(joinTokenPrefix + token)
+	value, err := s.store.Get(key)
+	if err != nil {
+		return errUnknownJoinToken
+	}
+	if err := s.store.Delete(key); err != nil {
+		return err
+	}
+	expiresAt, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return errExpiredJoinToken
+	}
+	return nil
+}
+
+// enrollBot consumes the join token and creates the bot credential at
+// once, so concurrent enrollments of the same bot can't both succeed. The
+// name of the bot certificate is bound to the bot.
+func (s *CommandServer) enrollBot(botId, token, certName string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.isEnrolled(botId) {
+		return "", errAlreadyEnrolled
+	}
+	if err := s.useJoinToken(token); err != nil {
+		return "", err
+	}
+	secret, err := randomHex(credentialSecretSz)
+	if err != nil {
+		return "", fmt.Errorf("can't generate bot credential: %v", err)
+	}
+	if err := s.store.Put([]byte(certNamePrefix+botId), []byte(certName)); err != nil {
+		return "", fmt.Errorf("can't save bot certificate name: %v", err)
+	}
+	if err := s.store.Put([]byte(credentialPrefix+botId), hashSecret(secret)); err != nil {
+		return "", fmt.Errorf("can't save bot credential: %v", err)
+	}
+	return secret, nil
+}
+
+// validBotId accepts the canonical UUIDs only, the bot ID is used as the
+// store key segment and the directory name.
+func validBotId(botId string) bool {
+	id, err := uuid.Parse(botId)
+	return err == nil && id.String() == botId
+}
+
+func (s *CommandServer) isEnrolled(botId string) bool {
+	return s.store.Has([]byte(credentialPrefix + botId))
+}
+
+// authenticate checks the credential the bot has got on enrollment.
+func (s *CommandServer) authenticate(botId, secret string) bool {
+	if botId == "" || secret == "" {
+		return false
+	}
+	expected, err := s.store.Get([]byte(credentialPrefix + botId))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(expected, hashSecret(secret)) == 1
+}
+
+// verifyPeer checks that the client certificate is the one the bot has
+// been enrolled with. The bot enrolled while TLS was off is bound to the
+// certificate it connects with first, the caller must have authenticated
+// the bot.
+func (s *CommandServer) verifyPeer(botId, certName string) error {
+	if !s.tlsEnabled() {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	key := []byte(certNamePrefix + botId)
+	expected, err := s.store.Get(key)
+	if err != nil && err != bitcask.ErrKeyNotFound {
+		return err
+	}
+	if len(expected) == 0 {
+		if err := s.store.Put(key, []byte(certName)); err != nil {
+			return fmt.Errorf("can't save bot certificate name: %v", err)
+		}
+		log.Printf("bot %s has been bound to client certificate %q\n", botId, certName)
+		return nil
+	}
+	if string(expected) != certName {
+		return fmt.Errorf("client certificate %q doesn't belong to bot %s", certName, botId)
+	}
+	return nil
+}
+
+// RevokeBot removes the bot credential and drops its connection, so the
+// bot has to be enrolled again with a new join token.
+func (s *CommandServer) RevokeBot(botId string) error {
+	if err := s.store.Delete([]byte(credentialPrefix + botId)); err != nil {
+		return err
+	}
+	if err := s.store.Delete([]byte(certNamePrefix + botId)); err != nil {
+		return err
+	}
+	s.RLock()
+	bot, ok := s.bots[botId]
+	s.RUnlock()
+	if ok {
+		_ = bot.Conn.Close()
+	}
+	return nil
+}
+
+func (s *CommandServer) enroll(w http.ResponseWriter, r *http.Request) {
+	certName, err := s.peerName(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	botId := query.Get("uuid")
+	if !validBotId(botId) {
+		http.Error(w, "incorrect bot id", http.StatusBadRequest)
+		return
+	}
+	secret, err := s.enrollBot(botId, query.Get("token"), certName)
+	if err != nil {
+		switch err {
+		case errAlreadyEnrolled:
+			log.Printf("bot %s tried to enroll again from %s\n", botId, r.RemoteAddr)
+			http.Error(w, "already enrolled", http.StatusForbidden)
+		case errUnknownJoinToken, errExpiredJoinToken:
+			log.Printf("bot %s enrollment error: %v\n", botId, err)
+			http.Error(w, "invalid join token", http.StatusForbidden)
+		default:
+			log.Println("error while enrolling bot: ", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if s.Debug {
+		log.Println("bot enrolled: ", botId)
+	}
+	_, _ = w.Write([]byte(secret))
+}
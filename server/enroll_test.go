@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/tls"
+	"github.com/xorium/wormwhole/core"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func enrollTestBot(t *testing.T, s *CommandServer, botId, certName string) string {
+	token, err := s.CreateJoinToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := s.enrollBot(botId, token, certName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestEnrollBot(t *testing.T) {
+	s := newTestServer(t)
+	token, err := s.CreateJoinToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := s.enrollBot(testBotId, token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.authenticate(testBotId, secret) {
+		t.Error("enrolled bot isn't authenticated")
+	}
+	for _, tt := range []struct{ botId, secret string }{
+		{testBotId, ""},
+		{testBotId, secret + "0"},
+		{testOtherBotId, secret},
+		{"", secret},
+	} {
+		if s.authenticate(tt.botId, tt.secret) {
+			t.Errorf("bot %q is authenticated with secret %q", tt.botId, tt.secret)
+		}
+	}
+
+	if _, err := s.enrollBot(testOtherBotId, token, ""); err != errUnknownJoinToken {
+		t.Errorf("reuse of join token error %v, want %v", err, errUnknownJoinToken)
+	}
+	other, err := s.CreateJoinToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.enrollBot(testBotId, other, ""); err != errAlreadyEnrolled {
+		t.Errorf("second enrollment error %v, want %v", err, errAlreadyEnrolled)
+	}
+	// the token isn't consumed by the rejected enrollment
+	if _, err := s.enrollBot(testOtherBotId, other, ""); err != nil {
+		t.Errorf("enrollment of other bot: %v", err)
+	}
+}
+
+func TestEnrollBotExpiredToken(t *testing.T) {
+	s := newTestServer(t)
+	expiresAt := time.Now().Add(-time.Minute).Unix()
+	if err := s.store.Put([]byte(joinTokenPrefix+"expired"), []byte(strconv.FormatInt(expiresAt, 10))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.enrollBot(testBotId, "expired", ""); err != errExpiredJoinToken {
+		t.Errorf("enrollment error %v, want %v", err, errExpiredJoinToken)
+	}
+	if s.isEnrolled(testBotId) {
+		t.Error("bot is enrolled with expired token")
+	}
+	if s.store.Has([]byte(joinTokenPrefix + "expired")) {
+		t.Error("expired token is kept")
+	}
+}
+
+func TestVerifyPeer(t *testing.T) {
+	s := newTestServer(t)
+	enrollTestBot(t, s, testBotId, "")
+	enrollTestBot(t, s, testOtherBotId, "bot1")
+	if err := s.verifyPeer(testBotId, "agent-b"); err != nil {
+		t.Errorf("verifyPeer without TLS: %v", err)
+	}
+
+	s.tlsConfig = &tls.Config{}
+	// the bot enrolled without TLS is bound to the first certificate
+	if err := s.verifyPeer(testBotId, "agent-b"); err != nil {
+		t.Errorf("first verifyPeer of bot enrolled without TLS: %v", err)
+	}
+	if err := s.verifyPeer(testBotId, "agent-b"); err != nil {
+		t.Errorf("verifyPeer of bound certificate: %v", err)
+	}
+	if err := s.verifyPeer(testBotId, "bot1"); err == nil {
+		t.Error("other certificate is accepted after binding")
+	}
+	if err := s.verifyPeer(testOtherBotId, "agent-b"); err == nil {
+		t.Error("certificate of other bot is accepted")
+	}
+	if err := s.verifyPeer(testOtherBotId, "bot1"); err != nil {
+		t.Errorf("verifyPeer of enrolled certificate: %v", err)
+	}
+}
+
+func TestRevokeBot(t *testing.T) {
+	s := newTestServer(t)
+	secret := enrollTestBot(t, s, testBotId, "bot1")
+	if err := s.RevokeBot(testBotId); err != nil {
+		t.Fatal(err)
+	}
+	if s.isEnrolled(testBotId) || s.authenticate(testBotId, secret) {
+		t.Error("revoked bot is authenticated")
+	}
+	if s.store.Has([]byte(certNamePrefix + testBotId)) {
+		t.Error("certificate name of revoked bot is kept")
+	}
+	if _, err := s.enrollBot(testBotId, "", ""); err != errUnknownJoinToken {
+		t.Errorf("enrollment without token error %v, want %v", err, errUnknownJoinToken)
+	}
+}
+
+func feedbackRequest(cmdId, botId, secret string) *http.Request {
+	query := url.Values{"cid": {cmdId}, "uuid": {botId}, "code": {core.CommandResultCodeSuccess}}
+	r := httptest.NewRequest(http.MethodPost, "/out?"+query.Encode(), nil)
+	r.Header.Set(core.CredentialHeader, secret)
+	return r
+}
+
+func TestFeedbackResultSender(t *testing.T) {
+	s := newTestServer(t)
+	responses := make(chan *core.Command, 1)
+	s.SetOnCommandRespHandler(func(cmd *core.Command, resp []byte) { responses <- cmd })
+	secret := enrollTestBot(t, s, testBotId, "")
+	otherSecret := enrollTestBot(t, s, testOtherBotId, "")
+	cmd := core.NewCommand("exec", "uptime")
+	cmd.SetTarget(testBotId)
+	s.Lock()
+	s.currentCommands[cmd.ID] = cmd
+	s.Unlock()
+
+	for _, r := range []*http.Request{
+		feedbackRequest("unknown", testBotId, secret),
+		feedbackRequest("", testBotId, secret),
+		feedbackRequest(cmd.ID, testOtherBotId, otherSecret),
+		feedbackRequest(cmd.ID, testBotId, otherSecret),
+		feedbackRequest(cmd.ID, testBotId, ""),
+	} {
+		w := httptest.NewRecorder()
+		s.feedback(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s status %d, want %d", r.URL, w.Code, http.StatusForbidden)
+		}
+	}
+	if rejected := s.Counters().RejectedResults; rejected != 5 {
+		t.Errorf("%d rejected results, want 5", rejected)
+	}
+	if cmd.State() != core.CommandStateUndefined {
+		t.Errorf("command state %s after rejected results", cmd.State())
+	}
+
+	w := httptest.NewRecorder()
+	s.feedback(w, feedbackRequest(cmd.ID, testBotId, secret))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	select {
+	case completed := <-responses:
+		if completed.ID != cmd.ID || completed.State() != core.CommandStateSuccess {
+			t.Errorf("completed command %s in state %s", completed.ID, completed.State())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("command isn't completed")
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/xorium/wormwhole/core"
+	"sync"
+)
+
+// metricsHistorySize is the number of samples kept per bot, an hour of
+// samples pushed every 10 seconds.
+const metricsHistorySize = 360
+
+// metricsRing keeps the last samples of the bot metrics.
+type metricsRing struct {
+	*sync.RWMutex
+	samples []*core.Metrics
+	next    int
+	full    bool
+}
+
+func newMetricsRing(size int) *metricsRing {
+	return &metricsRing{RWMutex: new(sync.RWMutex), samples: make([]*core.Metrics, size)}
+}
+
+func (r *metricsRing) add(metrics *core.Metrics) {
+	r.Lock()
+	defer r.Unlock()
+	r.samples[r.next] = metrics
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the samples from the oldest to the newest.
+func (r *metricsRing) list() []*core.Metrics {
+	r.RLock()
+	defer r.RUnlock()
+	if !r.full {
+		return append([]*core.Metrics(nil), r.samples[:r.next]...)
+	}
+	return append(append([]*core.Metrics(nil), r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+func (s *CommandServer) handleMetrics(bot *Bot, metrics *core.Metrics) {
+	s.Lock()
+	ring, ok := s.metrics[bot.ID]
+	if !ok {
+		ring = newMetricsRing(metricsHistorySize)
+		s.metrics[bot.ID] = ring
+	}
+	s.Unlock()
+	ring.add(metrics)
+}
+
+// Metrics returns the metrics samples of the bot from the oldest to the
+// newest, they are kept while the bot reconnects.
+func (s *CommandServer) Metrics(botId string) []*core.Metrics {
+	s.RLock()
+	ring, ok := s.metrics[botId]
+	s.RUnlock()
+	if !ok {
+		return nil
+	}
+	return ring.list()
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"log"
+	"strings"
+)
+
+const inventoryPrefix = "inventory:"
+
+// storeInventory saves the last package inventory reported by the bot.
+func (s *CommandServer) storeInventory(cmd *core.Command, respBody []byte) {
+	var inventory core.Inventory
+	if err := json.Unmarshal(respBody, &inventory); err != nil {
+		log.Printf("incorrect inventory of bot %s: %v\n", cmd.Target(), err)
+		return
+	}
+	if err := s.store.Put([]byte(inventoryPrefix+cmd.Target()), respBody); err != nil {
+		log.Println("error while saving bot inventory: ", err)
+	}
+}
+
+// Inventories returns the last package inventories of the bots, including
+// the disconnected ones, mapped by the bot ID.
+func (s *CommandServer) Inventories() (map[string]*core.Inventory, error) {
+	var keys [][]byte
+	err := s.store.Scan([]byte(inventoryPrefix), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	inventories := make(map[string]*core.Inventory, len(keys))
+	for _, key := range keys {
+		value, err := s.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		inventory := new(core.Inventory)
+		if err := json.Unmarshal(value, inventory); err != nil {
+			return nil, fmt.Errorf("incorrect inventory %s: %v", key, err)
+		}
+		inventories[strings.TrimPrefix(string(key), inventoryPrefix)] = inventory
+	}
+	return inventories, nil
+}
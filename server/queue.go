@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const queuePrefix = "queue:"
+
+// commands depending on the console or the server state while running
+var unqueueableCommands = map[string]bool{
+	"shell":    true,
+	"upload":   true,
+	"download": true,
+	"tail":     true,
+}
+
+// QueuedCommand is the command waiting for the offline bot to reconnect.
+type QueuedCommand struct {
+	BotID     string        `json:"bot_id"`
+	Command   *core.Command `json:"command"`
+	QueuedAt  time.Time     `json:"queued_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+func (q *QueuedCommand) Expired() bool {
+	return time.Now().After(q.ExpiresAt)
+}
+
+func queueKey(botId, cmdId string) []byte {
+	return []byte(queuePrefix + botId + ":" + cmdId)
+}
+
+// queueCommand saves the command of the known bot until it reconnects or
+// the command TTL expires.
+func (s *CommandServer) queueCommand(c *core.Command, botId string) error {
+	if unqueueableCommands[c.Name] {
+		return fmt.Errorf("command %s can't be queued", c.Name)
+	}
+	s.RLock()
+	record, err := s.loadBotRecord(botId)
+	s.RUnlock()
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("command %s execution error: unknown bot ID %s", c.Name, botId)
+	}
+	now := time.Now()
+	queued := &QueuedCommand{BotID: botId, Command: c, QueuedAt: now, ExpiresAt: now.Add(c.TTL)}
+	value, err := json.Marshal(queued)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Put(queueKey(botId, c.ID), value); err != nil {
+		return err
+	}
+	c.SetTarget(botId)
+	c.SetState(core.CommandStateQueued)
+	// the bot might have reconnected meanwhile
+	if bot := s.Bot(botId); bot != nil {
+		go s.deliverQueued(bot)
+	}
+	return nil
+}
+
+// QueuedCommands returns the queued commands of the bot, or of all the
+// bots if the ID is empty, sorted by the queueing time.
+func (s *CommandServer) QueuedCommands(botId string) ([]*QueuedCommand, error) {
+	prefix := queuePrefix
+	if botId != "" {
+		prefix += botId + ":"
+	}
+	var keys [][]byte
+	err := s.store.Scan([]byte(prefix), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]*QueuedCommand, 0, len(keys))
+	for _, key := range keys {
+		value, err := s.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		queued := &QueuedCommand{Command: &core.Command{RWMutex: new(sync.RWMutex)}}
+		if err := json.Unmarshal(value, queued); err != nil {
+			return nil, fmt.Errorf("incorrect queued command %s: %v", key, err)
+		}
+		queued.Command.SetTarget(queued.BotID)
+		queued.Command.SetState(core.CommandStateQueued)
+		commands = append(commands, queued)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].QueuedAt.Before(commands[j].QueuedAt)
+	})
+	return commands, nil
+}
+
+// DropQueuedCommand removes the queued command by ID.
+func (s *CommandServer) DropQueuedCommand(cmdId string) error {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	commands, err := s.QueuedCommands("")
+	if err != nil {
+		return err
+	}
+	for _, queued := range commands {
+		if queued.Command.ID == cmdId {
+			return s.store.Delete(queueKey(queued.BotID, cmdId))
+		}
+	}
+	return fmt.Errorf("unknown queued command %s", cmdId)
+}
+
+// deliverQueued sends the queued commands to the reconnected bot, the
+// expired ones are reported as failed.
+func (s *CommandServer) deliverQueued(bot *Bot) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	commands, err := s.QueuedCommands(bot.ID)
+	if err != nil {
+		log.Printf("can't load queued commands of bot %s: %v\n", bot.String(), err)
+		return
+	}
+	for _, queued := range commands {
+		cmd := queued.Command
+		key := queueKey(bot.ID, cmd.ID)
+		queuedAt := queued.QueuedAt
+		cmd.QueuedAt = &queuedAt
+		if queued.Expired() {
+			if err := s.store.Delete(key); err != nil {
+				log.Println("error while deleting queued command: ", err)
+			}
+			cmd.SetState(core.CommandStateFailed)
+			go s.onCommandRespHandler(cmd, []byte("command has expired in the queue"))
+			continue
+		}
+		sentAt := time.Now()
+		cmd.SentAt = &sentAt
+		if err := s.SendCommand(cmd, bot); err != nil {
+			if s.Debug {
+				log.Printf("can't deliver queued command to bot %s: %v\n", bot.String(), err)
+			}
+			return
+		}
+		if err := s.store.Delete(key); err != nil {
+			log.Println("error while deleting queued command: ", err)
+		}
+	}
+}
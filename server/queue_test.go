@@ -0,0 +1,132 @@
+package server
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/xorium/wormwhole/core"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newQueuedCommand(t *testing.T, s *CommandServer, id string, ttl time.Duration) *core.Command {
+	cmd := core.NewCommand("exec", "uptime").SetTTL(ttl)
+	cmd.ID = id
+	if err := s.SendCommand(cmd, &Bot{ID: testBotId}); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.State() != core.CommandStateQueued {
+		t.Fatalf("command %s state %s, want %s", id, cmd.State(), core.CommandStateQueued)
+	}
+	return cmd
+}
+
+// connectTestBot registers the bot connected over a real websocket and
+// returns the bot side of the connection.
+func connectTestBot(t *testing.T, s *CommandServer, botId string) (*Bot, *websocket.Conn) {
+	bots := make(chan *Bot, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := s.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		bots <- &Bot{ID: botId, Conn: c, writeLock: new(sync.Mutex), factsLock: new(sync.RWMutex)}
+	}))
+	t.Cleanup(ts.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	bot := <-bots
+	t.Cleanup(func() { _ = bot.Conn.Close() })
+	s.Lock()
+	s.bots[botId] = bot
+	s.Unlock()
+	return bot, conn
+}
+
+func TestQueueCommandRequiresKnownBot(t *testing.T) {
+	s := newTestServer(t)
+	cmd := core.NewCommand("exec", "uptime").SetTTL(time.Hour)
+	if err := s.SendCommand(cmd, &Bot{ID: testBotId}); err == nil {
+		t.Error("command of unknown bot is queued")
+	}
+	s.seeBot(&Bot{ID: testBotId}, nil)
+	if err := s.SendCommand(core.NewCommand("shell").SetTTL(time.Hour), &Bot{ID: testBotId}); err == nil {
+		t.Error("shell command is queued")
+	}
+	if commands, err := s.QueuedCommands(""); err != nil || len(commands) != 0 {
+		t.Errorf("queued commands %v, %v", commands, err)
+	}
+}
+
+func TestDropQueuedCommand(t *testing.T) {
+	s := newTestServer(t)
+	s.seeBot(&Bot{ID: testBotId}, nil)
+	newQueuedCommand(t, s, "1", time.Hour)
+	newQueuedCommand(t, s, "2", time.Hour)
+
+	if err := s.DropQueuedCommand("1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DropQueuedCommand("1"); err == nil {
+		t.Error("dropped command is dropped again")
+	}
+	if err := s.DropQueuedCommand("unknown"); err == nil {
+		t.Error("unknown command is dropped")
+	}
+	commands, err := s.QueuedCommands(testBotId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 || commands[0].Command.ID != "2" {
+		t.Errorf("queued commands %v, want command 2 only", commands)
+	}
+}
+
+func TestDeliverQueued(t *testing.T) {
+	s := newTestServer(t)
+	responses := make(chan *core.Command, 1)
+	s.SetOnCommandRespHandler(func(cmd *core.Command, resp []byte) { responses <- cmd })
+	s.seeBot(&Bot{ID: testBotId}, nil)
+	newQueuedCommand(t, s, "1", time.Hour)
+	newQueuedCommand(t, s, "expired", time.Nanosecond)
+	newQueuedCommand(t, s, "2", time.Hour)
+	newQueuedCommand(t, s, "3", time.Hour)
+
+	commands, err := s.QueuedCommands(testBotId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 4 || commands[0].Command.ID != "1" || commands[3].Command.ID != "3" {
+		t.Fatalf("queued commands %v, want them in queueing order", commands)
+	}
+
+	bot, conn := connectTestBot(t, s, testBotId)
+	s.deliverQueued(bot)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, id := range []string{"1", "2", "3"} {
+		msg := new(core.Message)
+		if err := conn.ReadJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != core.MessageTypeCommand || msg.Command.ID != id {
+			t.Errorf("delivered %s command %v, want command %s", msg.Type, msg.Command, id)
+		}
+	}
+
+	select {
+	case cmd := <-responses:
+		if cmd.ID != "expired" || cmd.State() != core.CommandStateFailed {
+			t.Errorf("reported command %s in state %s", cmd.ID, cmd.State())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expired command isn't reported")
+	}
+	if commands, err := s.QueuedCommands(""); err != nil || len(commands) != 0 {
+		t.Errorf("queued commands after delivery %v, %v", commands, err)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const botRecordPrefix = "bot:"
+
+// BotRecord is the persistent registry entry of the bot, it survives the
+// server restarts unlike the connected bots.
+type BotRecord struct {
+	ID        string            `json:"id"`
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+	LastIP    string            `json:"last_ip"`
+	Facts     *core.HostFacts   `json:"facts,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Online is set by the server when the record is returned
+	Online bool `json:"-"`
+}
+
+func (r *BotRecord) String() string {
+	return fmt.Sprintf("%s|%s", r.ID, r.LastIP)
+}
+
+func botRecordKey(botId string) []byte {
+	return []byte(botRecordPrefix + botId)
+}
+
+func (s *CommandServer) loadBotRecord(botId string) (*BotRecord, error) {
+	if !s.store.Has(botRecordKey(botId)) {
+		return nil, nil
+	}
+	value, err := s.store.Get(botRecordKey(botId))
+	if err != nil {
+		return nil, err
+	}
+	record := new(BotRecord)
+	if err := json.Unmarshal(value, record); err != nil {
+		return nil, fmt.Errorf("incorrect record of bot %s: %v", botId, err)
+	}
+	return record, nil
+}
+
+// updateBotRecord applies the update to the bot record, which is created
+// if the bot is seen for the first time.
+func (s *CommandServer) updateBotRecord(botId string, update func(record *BotRecord)) error {
+	s.Lock()
+	defer s.Unlock()
+	record, err := s.loadBotRecord(botId)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		record = &BotRecord{ID: botId, FirstSeen: time.Now()}
+	}
+	update(record)
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(botRecordKey(botId), value)
+}
+
+// seeBot updates the last seen time and address of the bot, and the facts
+// if they are given.
+func (s *CommandServer) seeBot(bot *Bot, facts *core.HostFacts) {
+	ip := bot.IP
+	if host, _, err := net.SplitHostPort(bot.IP); err == nil {
+		ip = host
+	}
+	err := s.updateBotRecord(bot.ID, func(record *BotRecord) {
+		record.LastSeen = time.Now()
+		record.LastIP = ip
+		if facts != nil {
+			record.Facts = facts
+		}
+	})
+	if err != nil {
+		log.Println("error while saving bot record: ", err)
+	}
+}
+
+// KnownBots returns the records of all the bots ever connected sorted by
+// the first seen time.
+func (s *CommandServer) KnownBots() ([]*BotRecord, error) {
+	var keys [][]byte
+	err := s.store.Scan([]byte(botRecordPrefix), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*BotRecord, 0, len(keys))
+	s.RLock()
+	defer s.RUnlock()
+	for _, key := range keys {
+		value, err := s.store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		record := new(BotRecord)
+		if err := json.Unmarshal(value, record); err != nil {
+			return nil, fmt.Errorf("incorrect bot record %s: %v", key, err)
+		}
+		_, record.Online = s.bots[record.ID]
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].FirstSeen.Before(records[j].FirstSeen)
+	})
+	return records, nil
+}
+
+// SetLabels merges the labels into the bot labels, the labels with empty
+// values are removed.
+func (s *CommandServer) SetLabels(botId string, labels map[string]string) error {
+	return s.updateBotRecord(botId, func(record *BotRecord) {
+		if record.Labels == nil {
+			record.Labels = make(map[string]string)
+		}
+		for key, value := range labels {
+			if value == "" {
+				delete(record.Labels, key)
+				continue
+			}
+			record.Labels[key] = value
+		}
+	})
+}
+
+// OfflineBot returns the handle of the disconnected bot, the commands with
+// TTL sent to it are queued.
+func (r *BotRecord) OfflineBot() *Bot {
+	return &Bot{
+		ID:        r.ID,
+		IP:        r.LastIP,
+		facts:     r.Facts,
+		writeLock: new(sync.Mutex),
+		factsLock: new(sync.RWMutex),
+	}
+}
+
+// Bot returns the connected bot by ID, nil if it's offline.
+func (s *CommandServer) Bot(botId string) *Bot {
+	s.RLock()
+	defer s.RUnlock()
+	return s.bots[botId]
+}
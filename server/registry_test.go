@@ -0,0 +1,107 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateBotRecord(t *testing.T) {
+	s := newTestServer(t)
+	if record, err := s.loadBotRecord(testBotId); err != nil || record != nil {
+		t.Fatalf("record of unknown bot %v, %v", record, err)
+	}
+	s.seeBot(&Bot{ID: testBotId, IP: "10.0.0.1:5555"}, nil)
+	first, err := s.loadBotRecord(testBotId)
+	if err != nil || first == nil {
+		t.Fatalf("record %v, %v", first, err)
+	}
+	if first.ID != testBotId || first.LastIP != "10.0.0.1" || first.FirstSeen.IsZero() {
+		t.Errorf("record %+v", first)
+	}
+
+	s.seeBot(&Bot{ID: testBotId, IP: "10.0.0.2:5555"}, nil)
+	second, err := s.loadBotRecord(testBotId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.FirstSeen.Equal(first.FirstSeen) {
+		t.Errorf("first seen time changed from %v to %v", first.FirstSeen, second.FirstSeen)
+	}
+	if second.LastIP != "10.0.0.2" || second.LastSeen.Before(first.LastSeen) {
+		t.Errorf("record %+v after %+v", second, first)
+	}
+}
+
+func TestBotRecordPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewCommandServer("127.0.0.1:0", store)
+	s.seeBot(&Bot{ID: testBotId, IP: "10.0.0.1:5555"}, nil)
+	if err := s.SetLabels(testBotId, map[string]string{"env": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	s = NewCommandServer("127.0.0.1:0", store)
+	records, err := s.KnownBots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("%d records after restart, want 1", len(records))
+	}
+	record := records[0]
+	if record.ID != testBotId || record.LastIP != "10.0.0.1" || record.Labels["env"] != "prod" {
+		t.Errorf("record after restart %+v", record)
+	}
+	if record.Online {
+		t.Error("bot is online after restart")
+	}
+}
+
+func TestSetLabels(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.SetLabels(testBotId, map[string]string{"env": "prod", "role": "db"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetLabels(testBotId, map[string]string{"env": "", "dc": "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	record, err := s.loadBotRecord(testBotId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Labels) != 2 || record.Labels["role"] != "db" || record.Labels["dc"] != "eu" {
+		t.Errorf("labels %v, want role=db and dc=eu", record.Labels)
+	}
+}
+
+func TestKnownBotsOrder(t *testing.T) {
+	s := newTestServer(t)
+	s.seeBot(&Bot{ID: testOtherBotId, IP: "10.0.0.2:5555"}, nil)
+	s.seeBot(&Bot{ID: testBotId, IP: "10.0.0.1:5555"}, nil)
+	s.Lock()
+	s.bots[testBotId] = &Bot{ID: testBotId}
+	s.Unlock()
+
+	records, err := s.KnownBots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != testOtherBotId || records[1].ID != testBotId {
+		t.Fatalf("records %v, want %s first", records, testOtherBotId)
+	}
+	if records[0].Online || !records[1].Online {
+		t.Errorf("online flags %v and %v, want false and true", records[0].Online, records[1].Online)
+	}
+}
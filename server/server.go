@@ -1,8 +1,10 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/gorilla/websocket"
+	"github.com/prologic/bitcask"
 	"github.com/xorium/wormwhole/core"
 	"io/ioutil"
 	"log"
@@ -19,42 +21,98 @@ func defaultCommandRespHandler(c *core.Command, data []byte) {
 	log.Println(c.ID, string(data))
 }
 
+func defaultCommandChunkHandler(c *core.Command, chunk *core.Chunk) {
+	log.Println(c.ID, chunk.Stream, chunk.Seq, string(chunk.Data))
+}
+
+func defaultSessionDataHandler(c *core.Command, data []byte) {
+	log.Println(c.ID, string(data))
+}
+
 type Bot struct {
-	ID   string
-	IP   string
-	Conn *websocket.Conn
+	ID        string
+	IP        string
+	CertName  string
+	Conn      *websocket.Conn
+	writeLock *sync.Mutex
+	facts     *core.HostFacts
+	factsLock *sync.RWMutex
 }
 
 func (b *Bot) String() string {
 	return fmt.Sprintf("%s|%s", b.ID, b.IP)
 }
 
+// Facts returns the host facts the bot reported, nil if there are none yet.
+func (b *Bot) Facts() *core.HostFacts {
+	b.factsLock.RLock()
+	defer b.factsLock.RUnlock()
+	return b.facts
+}
+
+func (b *Bot) setFacts(facts *core.HostFacts) {
+	b.factsLock.Lock()
+	b.facts = facts
+	b.factsLock.Unlock()
+}
+
+func (b *Bot) send(msg *core.Message) error {
+	b.writeLock.Lock()
+	defer b.writeLock.Unlock()
+	return b.Conn.WriteJSON(msg)
+}
+
 type CommandServer struct {
 	*sync.RWMutex
 	Debug           bool
+	MaxDownloadSize int64
 	addr            string
 	upgrader        websocket.Upgrader
+	tlsConfig       *tls.Config
+	store           *bitcask.Bitcask
+	counters        *Counters
 	bots            map[string]*Bot
 	currentCommands map[string]*core.Command
-
-	onConnectHandler     func(*Bot)
-	onDisconnectHandler  func(*Bot)
-	onCommandRespHandler func(*core.Command, []byte)
+	calls           map[string]chan []byte
+	uploads         map[string]*upload
+	downloads       map[string]*download
+	downloadDir     string
+	artifacts       *ArtifactStore
+	metrics         map[string]*metricsRing
+	queueLock       *sync.Mutex
+
+	onConnectHandler      func(*Bot)
+	onDisconnectHandler   func(*Bot)
+	onCommandRespHandler  func(*core.Command, []byte)
+	onCommandChunkHandler func(*core.Command, *core.Chunk)
+	onSessionDataHandler  func(*core.Command, []byte)
 }
 
-func NewCommandServer(addr string) *CommandServer {
+func NewCommandServer(addr string, store *bitcask.Bitcask) *CommandServer {
 	return &CommandServer{
-		RWMutex: new(sync.RWMutex),
-		addr:    addr,
+		RWMutex:  new(sync.RWMutex),
+		addr:     addr,
+		store:    store,
+		counters: new(Counters),
 		upgrader: websocket.Upgrader{
 			HandshakeTimeout: 5 * time.Second,
 		},
 		bots:            make(map[string]*Bot),
 		currentCommands: make(map[string]*core.Command),
-
-		onConnectHandler:     defaultBotEventHandler,
-		onDisconnectHandler:  defaultBotEventHandler,
-		onCommandRespHandler: defaultCommandRespHandler,
+		calls:           make(map[string]chan []byte),
+		uploads:         make(map[string]*upload),
+		downloads:       make(map[string]*download),
+		metrics:         make(map[string]*metricsRing),
+		queueLock:       new(sync.Mutex),
+		downloadDir:     defaultDownloadDir,
+		artifacts:       newArtifactStore(store, defaultArtifactDir, defaultArtifactQuota),
+		MaxDownloadSize: defaultMaxDownloadSize,
+
+		onConnectHandler:      defaultBotEventHandler,
+		onDisconnectHandler:   defaultBotEventHandler,
+		onCommandRespHandler:  defaultCommandRespHandler,
+		onCommandChunkHandler: defaultCommandChunkHandler,
+		onSessionDataHandler:  defaultSessionDataHandler,
 	}
 }
 
@@ -76,10 +134,33 @@ func (s *CommandServer) SetOnCommandRespHandler(h func(*core.Command, []byte)) {
 	s.Unlock()
 }
 
+// SetOnCommandChunkHandler sets the handler of streamed command output.
+// The handler is called sequentially for chunks of the same bot.
+func (s *CommandServer) SetOnCommandChunkHandler(h func(*core.Command, *core.Chunk)) {
+	s.Lock()
+	s.onCommandChunkHandler = h
+	s.Unlock()
+}
+
+// SetOnSessionDataHandler sets the handler of the terminal output of PTY
+// sessions. The handler is called sequentially for the same bot.
+func (s *CommandServer) SetOnSessionDataHandler(h func(*core.Command, []byte)) {
+	s.Lock()
+	s.onSessionDataHandler = h
+	s.Unlock()
+}
+
 func (s *CommandServer) onDisconnect(bot *Bot) {
 	s.Lock()
+	current, ok := s.bots[bot.ID]
+	// the bot might have already reconnected with the same ID
+	if !ok || current != bot {
+		s.Unlock()
+		return
+	}
 	delete(s.bots, bot.ID)
 	s.Unlock()
+	s.seeBot(bot, nil)
 	s.onDisconnectHandler(bot)
 }
 
@@ -89,38 +170,76 @@ func (s *CommandServer) onConnect(bot *Bot) {
 
 func (s *CommandServer) removeBot(bot *Bot) {
 	s.Lock()
-	defer s.Unlock()
 	delete(s.bots, bot.ID)
 
+	var commandIds []string
 	for commandId, command := range s.currentCommands {
 		if command.Target() == bot.ID {
 			delete(s.currentCommands, commandId)
+			commandIds = append(commandIds, commandId)
 		}
 	}
+	s.Unlock()
+	for _, commandId := range commandIds {
+		s.releaseTransfers(commandId)
+	}
+}
+
+// releaseTransfers drops the files of the deleted upload or download
+// command.
+func (s *CommandServer) releaseTransfers(cmdId string) {
+	s.finishUpload(cmdId)
+	s.abortDownload(cmdId)
 }
 
 func (s *CommandServer) entrypoint(w http.ResponseWriter, r *http.Request) {
-	c, err := s.upgrader.Upgrade(w, r, nil)
+	certName, err := s.peerName(r)
 	if err != nil {
 		if s.Debug {
-			log.Println("upgrade ws connection error:", err)
+			log.Printf("rejected connection from %s: %v\n", r.RemoteAddr, err)
 		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	query := r.URL.Query()
 	botId := query.Get("uuid")
-	if botId == "" {
-		log.Println("connected bot with empty id")
+	if !validBotId(botId) {
+		log.Printf("connected bot with incorrect id %q\n", botId)
+		http.Error(w, "incorrect bot id", http.StatusBadRequest)
+		return
+	}
+	if !s.authenticate(botId, r.Header.Get(core.CredentialHeader)) {
+		if s.Debug {
+			log.Printf("rejected unenrolled bot %s from %s\n", botId, r.RemoteAddr)
+		}
+		http.Error(w, core.CredentialRejected, http.StatusUnauthorized)
+		return
+	}
+	if err := s.verifyPeer(botId, certName); err != nil {
+		log.Printf("rejected bot %s from %s: %v\n", botId, r.RemoteAddr, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	c, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		if s.Debug {
+			log.Println("upgrade ws connection error:", err)
+		}
 		return
 	}
 	bot := &Bot{
-		ID:   botId,
-		IP:   r.RemoteAddr,
-		Conn: c,
+		ID:        botId,
+		IP:        r.RemoteAddr,
+		CertName:  certName,
+		Conn:      c,
+		writeLock: new(sync.Mutex),
+		factsLock: new(sync.RWMutex),
 	}
 
 	s.startHeartBeating(bot)
+	go s.readMessages(bot)
 
 	if s.Debug {
 		log.Println("bot connected: ", bot.String())
@@ -131,40 +250,40 @@ func (s *CommandServer) entrypoint(w http.ResponseWriter, r *http.Request) {
 		return nil
 	})
 
+	s.seeBot(bot, nil)
 	s.Lock()
 	s.bots[bot.ID] = bot
 	s.Unlock()
 	go s.onConnect(bot)
+	go s.resumeUploads(bot)
+	go s.deliverQueued(bot)
 }
 
 func (s *CommandServer) feedback(w http.ResponseWriter, r *http.Request) {
-	defer func() { _, _ = w.Write([]byte("ok")) }()
-
-	query := r.URL.Query()
-
-	commandId := query.Get("cid")
-	if commandId == "" {
+	certName, err := s.peerName(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	query := r.URL.Query()
+	commandId := query.Get("cid")
 	s.RLock()
 	cmd, ok := s.currentCommands[commandId]
 	s.RUnlock()
 	if !ok {
+		s.counters.addRejectedResult()
+		log.Printf("rejected unknown command %q result from %s\n", commandId, r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
-
-	respCode := query.Get("code")
-	if respCode == "" {
-		respCode = core.CommandResultCodeSuccess
-		cmd.SetState(core.CommandStateSuccess)
-	}
-	if respCode != core.CommandResultCodeSuccess {
-		cmd.SetState(core.CommandStateFailed)
-		if s.Debug {
-			log.Printf("Command %s resp code: %s\n", commandId, respCode)
-		}
+	if err := s.verifyResultSender(cmd, r, certName); err != nil {
+		s.counters.addRejectedResult()
+		log.Printf("rejected command %s result from %s: %v\n", commandId, r.RemoteAddr, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
 	}
+	defer func() { _, _ = w.Write([]byte("ok")) }()
 
 	respBody := make([]byte, 0)
 	if r.Method == http.MethodPost {
@@ -175,44 +294,169 @@ func (s *CommandServer) feedback(w http.ResponseWriter, r *http.Request) {
 			respBody = body
 		}
 	}
+	s.completeCommand(cmd, query.Get("code"), respBody)
+}
+
+func (s *CommandServer) completeCommand(cmd *core.Command, respCode string, respBody []byte) {
+	if respCode == "" {
+		respCode = core.CommandResultCodeSuccess
+	}
+	s.finishUpload(cmd.ID)
+	respCode, respBody = s.finishDownload(cmd.ID, respCode, respBody)
+	switch respCode {
+	case core.CommandResultCodeSuccess:
+		cmd.SetState(core.CommandStateSuccess)
+	case core.CommandResultCodeInterrupted:
+		cmd.SetState(core.CommandStateInterrupted)
+	case core.CommandResultCodeTimedOut:
+		cmd.SetState(core.CommandStateTimedOut)
+	default:
+		cmd.SetState(core.CommandStateFailed)
+		if s.Debug {
+			log.Printf("Command %s resp code: %s\n", cmd.ID, respCode)
+		}
+	}
+
+	if cmd.Name == "packages" && cmd.State() == core.CommandStateSuccess {
+		s.storeInventory(cmd, respBody)
+	}
 
 	s.Lock()
 	delete(s.currentCommands, cmd.ID)
+	call, ok := s.calls[cmd.ID]
 	s.Unlock()
+	if ok {
+		call <- respBody
+		return
+	}
 	go s.onCommandRespHandler(cmd, respBody)
 }
 
-func (s *CommandServer) reccon(w http.ResponseWriter, r *http.Request) {
-	defer func() { _, _ = w.Write([]byte("ok")) }()
-
-	query := r.URL.Query()
-	dirName := query.Get("n")
-	if dirName == "" {
-		dirName = "unknown"
+func (s *CommandServer) readMessages(bot *Bot) {
+	for {
+		msg := new(core.Message)
+		if err := bot.Conn.ReadJSON(msg); err != nil {
+			if s.Debug {
+				log.Printf("can't read message from bot %s: %v\n", bot.String(), err)
+			}
+			s.onDisconnect(bot)
+			return
+		}
+		s.handleMessage(bot, msg)
 	}
+}
 
-	data := make([]byte, 0)
-	if r.Method == http.MethodPost {
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			log.Printf("error while reading reccon data: %v\n", err.Error())
-		} else {
-			data = body
+func (s *CommandServer) handleMessage(bot *Bot, msg *core.Message) {
+	switch msg.Type {
+	case core.MessageTypeHello:
+		if msg.Facts != nil {
+			bot.setFacts(msg.Facts)
+			s.seeBot(bot, msg.Facts)
+		}
+	case core.MessageTypeMetrics:
+		if msg.Metrics != nil {
+			s.handleMetrics(bot, msg.Metrics)
+		}
+	case core.MessageTypeResult:
+		if msg.Result != nil {
+			s.handleResult(bot, msg.Result)
+		}
+	case core.MessageTypeChunk:
+		if msg.Chunk != nil {
+			s.handleChunk(bot, msg.Chunk)
+		}
+	case core.MessageTypePTYData:
+		if msg.PTY != nil {
+			s.handleSessionData(bot, msg.PTY)
+		}
+	case core.MessageTypeUploadAck:
+		if msg.Transfer != nil {
+			s.handleUploadAck(bot, msg.Transfer)
+		}
+	case core.MessageTypeDownloadData:
+		if msg.Transfer != nil {
+			s.handleDownloadData(bot, msg.Transfer)
+		}
+	default:
+		if s.Debug {
+			log.Printf("unexpected message type %q from bot %s\n", msg.Type, bot.String())
 		}
 	}
+}
 
-	err := ioutil.WriteFile(fmt.Sprintf("/tmp/%s", dirName), data, 0644)
-	if err != nil {
-		log.Println("error while saving dirName data: ", err)
+// botCommand returns the current command sent to the bot.
+func (s *CommandServer) botCommand(bot *Bot, commandId string) (*core.Command, bool) {
+	s.RLock()
+	cmd, ok := s.currentCommands[commandId]
+	s.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if cmd.Target() != bot.ID {
+		s.counters.addRejectedResult()
+		log.Printf("rejected command %s data from foreign bot %s\n", cmd.ID, bot.String())
+		return nil, false
+	}
+	return cmd, true
+}
+
+func (s *CommandServer) handleResult(bot *Bot, result *core.Result) {
+	if cmd, ok := s.botCommand(bot, result.CommandID); ok {
+		s.completeCommand(cmd, result.Code, result.Data)
 	}
 }
 
+func (s *CommandServer) handleSessionData(bot *Bot, frame *core.PTYFrame) {
+	cmd, ok := s.botCommand(bot, frame.SessionID)
+	if !ok {
+		return
+	}
+	s.RLock()
+	handler := s.onSessionDataHandler
+	s.RUnlock()
+	handler(cmd, frame.Data)
+}
+
+func (s *CommandServer) handleChunk(bot *Bot, chunk *core.Chunk) {
+	cmd, ok := s.botCommand(bot, chunk.CommandID)
+	if !ok {
+		return
+	}
+	s.RLock()
+	handler := s.onCommandChunkHandler
+	s.RUnlock()
+	handler(cmd, chunk)
+}
+
+// verifyResultSender checks that the result comes from the bot the
+// command has been sent to.
+func (s *CommandServer) verifyResultSender(cmd *core.Command, r *http.Request, certName string) error {
+	botId := r.URL.Query().Get("uuid")
+	if botId != cmd.Target() {
+		return fmt.Errorf("command target is %s, not %q", cmd.Target(), botId)
+	}
+	if !s.authenticate(botId, r.Header.Get(core.CredentialHeader)) {
+		return fmt.Errorf("invalid credential of bot %s", botId)
+	}
+	// the bot is usually disconnected when it falls back to /out
+	return s.verifyPeer(botId, certName)
+}
+
 func (s *CommandServer) SendCommand(c *core.Command, bot *Bot) error {
+	botId := bot.ID
 	s.RLock()
-	bot, ok := s.bots[bot.ID]
+	bot, ok := s.bots[botId]
 	s.RUnlock()
+	if !ok && c.TTL > 0 {
+		err := s.queueCommand(c, botId)
+		if err != nil {
+			s.releaseTransfers(c.ID)
+		}
+		return err
+	}
 	if !ok {
-		return fmt.Errorf("command %s execution error: unknown bot ID %s", c.Name, bot.ID)
+		s.releaseTransfers(c.ID)
+		return fmt.Errorf("command %s execution error: unknown bot ID %s", c.Name, botId)
 	}
 
 	c.SetState(core.CommandStateExecuting)
@@ -221,19 +465,92 @@ func (s *CommandServer) SendCommand(c *core.Command, bot *Bot) error {
 	s.currentCommands[c.ID] = c
 	s.Unlock()
 
-	if err := bot.Conn.WriteJSON(c); err != nil {
+	if err := bot.send(core.NewCommandMessage(c)); err != nil {
 		if s.Debug {
 			log.Printf("can't send command %s to bot %s\n", c.Name, bot.String())
 		}
 		go s.onDisconnect(bot)
 		s.removeBot(bot)
-		delete(s.currentCommands, c.ID)
+		s.DeleteCommand(c.ID)
 		return err
 	}
 
 	return nil
 }
 
+// Call sends the command and waits for its result, which isn't passed to
+// the command response handler.
+func (s *CommandServer) Call(c *core.Command, bot *Bot, timeout time.Duration) ([]byte, error) {
+	result := make(chan []byte, 1)
+	s.Lock()
+	s.calls[c.ID] = result
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.calls, c.ID)
+		s.Unlock()
+	}()
+
+	c.SetTimeout(timeout)
+	if err := s.SendCommand(c, bot); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-result:
+		if c.State() != core.CommandStateSuccess {
+			return nil, fmt.Errorf("command %s error: %s", c.Name, resp)
+		}
+		return resp, nil
+	case <-time.After(timeout):
+		_ = s.CancelCommand(c.ID)
+		return nil, fmt.Errorf("command %s timed out", c.Name)
+	}
+}
+
+// commandBot returns the current command and the connected bot it has
+// been sent to.
+func (s *CommandServer) commandBot(cmdId string) (*core.Command, *Bot, error) {
+	s.RLock()
+	defer s.RUnlock()
+	cmd, ok := s.currentCommands[cmdId]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown command %s", cmdId)
+	}
+	bot, ok := s.bots[cmd.Target()]
+	if !ok {
+		return cmd, nil, fmt.Errorf("command %s target bot is disconnected", cmdId)
+	}
+	return cmd, bot, nil
+}
+
+// CancelCommand marks the command interrupted and asks the bot to stop it.
+func (s *CommandServer) CancelCommand(cmdId string) error {
+	cmd, bot, err := s.commandBot(cmdId)
+	if cmd != nil {
+		cmd.SetState(core.CommandStateInterrupted)
+	}
+	if err != nil {
+		return err
+	}
+	return bot.send(core.NewCancelMessage(cmdId))
+}
+
+func (s *CommandServer) SendSessionInput(sessionId string, data []byte) error {
+	_, bot, err := s.commandBot(sessionId)
+	if err != nil {
+		return err
+	}
+	return bot.send(core.NewPTYDataMessage(sessionId, data))
+}
+
+func (s *CommandServer) ResizeSession(sessionId string, rows, cols uint16) error {
+	_, bot, err := s.commandBot(sessionId)
+	if err != nil {
+		return err
+	}
+	return bot.send(core.NewPTYResizeMessage(sessionId, rows, cols))
+}
+
 func (s *CommandServer) ListBots() []*Bot {
 	s.RLock()
 	defer s.RUnlock()
@@ -258,6 +575,7 @@ func (s *CommandServer) DeleteCommand(cmdId string) {
 	s.Lock()
 	delete(s.currentCommands, cmdId)
 	s.Unlock()
+	s.releaseTransfers(cmdId)
 }
 
 func (s *CommandServer) startHeartBeating(bot *Bot) {
@@ -269,8 +587,8 @@ func (s *CommandServer) startHeartBeating(bot *Bot) {
 		}()
 
 		for range ticker.C {
-			_ = bot.Conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-			if err := bot.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			deadline := time.Now().Add(2 * time.Second)
+			if err := bot.Conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
 				s.onDisconnect(bot)
 				return
 			}
@@ -280,7 +598,19 @@ func (s *CommandServer) startHeartBeating(bot *Bot) {
 
 func (s *CommandServer) Run() {
 	http.HandleFunc("/in", s.entrypoint)
+	http.HandleFunc("/enroll", s.enroll)
 	http.HandleFunc("/out", s.feedback)
 	http.HandleFunc("/rec", s.reccon)
-	log.Fatal(http.ListenAndServe(s.addr, nil))
+
+	s.RLock()
+	tlsConfig := s.tlsConfig
+	s.RUnlock()
+	if tlsConfig == nil {
+		log.Fatal(http.ListenAndServe(s.addr, nil))
+	}
+	httpServer := &http.Server{
+		Addr:      s.addr,
+		TLSConfig: tlsConfig,
+	}
+	log.Fatal(httpServer.ListenAndServeTLS("", ""))
 }
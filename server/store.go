@@ -0,0 +1,22 @@
+package server
+
+import (
+	"github.com/prologic/bitcask"
+)
+
+const (
+	storeMaxKeySize   = 256
+	storeMaxValueSize = 16 << 20
+)
+
+func OpenStore(path string) (*bitcask.Bitcask, error) {
+	return bitcask.Open(
+		path,
+		bitcask.WithMaxKeySize(storeMaxKeySize),
+		bitcask.WithMaxValueSize(storeMaxValueSize),
+	)
+}
+
+func (s *CommandServer) Store() *bitcask.Bitcask {
+	return s.store
+}
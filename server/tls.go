@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"net/http"
+)
+
+func (s *CommandServer) SetTLS(certFile, keyFile, clientCAFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("can't load server certificate: %v", err)
+	}
+	clientCAs, err := core.LoadCertPool(clientCAFile)
+	if err != nil {
+		return fmt.Errorf("can't load client CA: %v", err)
+	}
+
+	s.Lock()
+	s.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	s.Unlock()
+	return nil
+}
+
+func (s *CommandServer) tlsEnabled() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.tlsConfig != nil
+}
+
+// peerName returns the common name of the verified client certificate or
+// an empty string if the server works without TLS.
+func (s *CommandServer) peerName(r *http.Request) (string, error) {
+	if !s.tlsEnabled() {
+		return "", nil
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", fmt.Errorf("no verified client certificate")
+	}
+	peerCert := r.TLS.VerifiedChains[0][0]
+	if peerCert.Subject.CommonName == "" {
+		return "", fmt.Errorf("client certificate has empty common name")
+	}
+	return peerCert.Subject.CommonName, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"github.com/xorium/wormwhole/core"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// upload is the local file sent to the bot by the upload command.
+type upload struct {
+	*sync.Mutex
+	file *os.File
+	size int64
+	// closed to stop the current sender
+	stop chan struct{}
+}
+
+func (u *upload) restartSender() chan struct{} {
+	u.Lock()
+	defer u.Unlock()
+	if u.stop != nil {
+		close(u.stop)
+	}
+	u.stop = make(chan struct{})
+	return u.stop
+}
+
+func (u *upload) close() {
+	u.Lock()
+	defer u.Unlock()
+	if u.stop != nil {
+		close(u.stop)
+		u.stop = nil
+	}
+	_ = u.file.Close()
+}
+
+// NewUpload creates the upload command of the local file. The file is sent
+// after the command is sent to the bot and it's sent again from the last
+// received offset if the bot reconnects while the command is running.
+func (s *CommandServer) NewUpload(localPath string, req core.UploadRequest) (*core.Command, error) {
+	checksum, err := core.FileSHA256(localPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s is not a regular file", localPath)
+	}
+	req.Size = info.Size()
+	req.SHA256 = checksum
+
+	cmd := UploadCommand(req)
+	s.Lock()
+	s.uploads[cmd.ID] = &upload{Mutex: new(sync.Mutex), file: f, size: req.Size}
+	s.Unlock()
+	return cmd, nil
+}
+
+func (s *CommandServer) finishUpload(cmdId string) {
+	s.Lock()
+	u, ok := s.uploads[cmdId]
+	delete(s.uploads, cmdId)
+	s.Unlock()
+	if ok {
+		u.close()
+	}
+}
+
+func (s *CommandServer) handleUploadAck(bot *Bot, ack *core.TransferChunk) {
+	if _, ok := s.botCommand(bot, ack.CommandID); !ok {
+		return
+	}
+	s.RLock()
+	u, ok := s.uploads[ack.CommandID]
+	s.RUnlock()
+	if !ok {
+		return
+	}
+	if ack.Offset < 0 || ack.Offset > u.size {
+		log.Printf("incorrect upload %s offset %d from bot %s\n", ack.CommandID, ack.Offset, bot.String())
+		return
+	}
+	go s.sendUpload(bot, ack.CommandID, u, ack.Offset, u.restartSender())
+}
+
+func (s *CommandServer) sendUpload(bot *Bot, cmdId string, u *upload, offset int64, stop chan struct{}) {
+	buf := make([]byte, core.TransferChunkSize)
+	for offset < u.size {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		n, err := u.file.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			log.Printf("error while reading upload %s: %v\n", cmdId, err)
+			return
+		}
+		if n == 0 {
+			log.Printf("upload %s file has been truncated\n", cmdId)
+			return
+		}
+		if err := bot.send(core.NewUploadDataMessage(cmdId, offset, buf[:n])); err != nil {
+			if s.Debug {
+				log.Printf("can't send upload %s data to bot %s: %v\n", cmdId, bot.String(), err)
+			}
+			return
+		}
+		offset += int64(n)
+	}
+}
+
+// resumeUploads sends the running upload commands to the reconnected bot,
+// which acknowledges the offset to continue from.
+func (s *CommandServer) resumeUploads(bot *Bot) {
+	s.RLock()
+	var commands []*core.Command
+	for cmdId := range s.uploads {
+		if cmd, ok := s.currentCommands[cmdId]; ok && cmd.Target() == bot.ID {
+			commands = append(commands, cmd)
+		}
+	}
+	s.RUnlock()
+	for _, cmd := range commands {
+		if err := bot.send(core.NewCommandMessage(cmd)); err != nil {
+			log.Printf("can't resume upload %s on bot %s: %v\n", cmd.ID, bot.String(), err)
+			return
+		}
+	}
+}